@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lox/tmux-mcp-server/internal/config"
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+)
+
+// checkResult is the outcome of a single doctor check
+type checkResult struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+func runDoctor(args []string) int {
+	fs, loader := newFlagSet("doctor")
+	cfg, code := parseConfig(fs, loader, args)
+	if code >= 0 {
+		return code
+	}
+
+	checks := []func(config.Config) checkResult{
+		checkTmuxVersion,
+		checkSocket,
+		checkShell,
+		checkTerminalSize,
+		checkPolicy,
+		checkTemplates,
+		checkMacros,
+		checkSandbox,
+	}
+
+	failed := 0
+	for _, check := range checks {
+		result := check(cfg)
+		status := "ok  "
+		if !result.ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("[%s] %-14s %s\n", status, result.name, result.detail)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+func checkTmuxVersion(config.Config) checkResult {
+	caps, err := tmux.DetectCapabilities()
+	if err != nil {
+		return checkResult{"tmux", false, err.Error()}
+	}
+
+	var unsupported []string
+	for _, f := range tmux.Features {
+		if !caps.Supports(f) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (needs %s)", f.Name, f.Min))
+		}
+	}
+
+	detail := fmt.Sprintf("tmux %s (minimum %s)", caps.Version, tmux.MinimumVersion)
+	if len(unsupported) > 0 {
+		detail += "; unavailable: " + strings.Join(unsupported, ", ")
+	}
+	return checkResult{"tmux", true, detail}
+}
+
+func checkSocket(config.Config) checkResult {
+	path := tmux.SocketFile()
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		// No server yet; the directory tmux creates it in must be private if it exists
+		dir := filepath.Dir(path)
+		if dirInfo, err := os.Stat(dir); err == nil && dirInfo.Mode().Perm()&0o077 != 0 {
+			return checkResult{"socket", false, fmt.Sprintf("%s has permissions %v; tmux requires 0700", dir, dirInfo.Mode().Perm())}
+		}
+		return checkResult{"socket", true, fmt.Sprintf("%s (no server running yet)", path)}
+	}
+	if err != nil {
+		return checkResult{"socket", false, err.Error()}
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return checkResult{"socket", false, fmt.Sprintf("%s exists but is not a socket", path)}
+	}
+	if info.Mode().Perm()&0o007 != 0 {
+		return checkResult{"socket", false, fmt.Sprintf("%s is accessible to other users (%v)", path, info.Mode().Perm())}
+	}
+
+	return checkResult{"socket", true, fmt.Sprintf("%s (%v)", path, info.Mode().Perm())}
+}
+
+func checkShell(config.Config) checkResult {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	if _, err := exec.LookPath(shell); err != nil {
+		return checkResult{"default shell", false, fmt.Sprintf("%s is not executable: %v", shell, err)}
+	}
+	return checkResult{"default shell", true, shell}
+}
+
+func checkTerminalSize(cfg config.Config) checkResult {
+	name := fmt.Sprintf("tmux-mcp-doctor-%d", os.Getpid())
+	if err := tmux.StartSession(context.Background(), name, "sleep 5", ""); err != nil {
+		return checkResult{"terminal size", false, fmt.Sprintf("failed to start probe session: %v", err)}
+	}
+	defer func() { _ = tmux.KillSession(context.Background(), name) }()
+
+	args := append(tmux.SocketArgs(), "display-message", "-p", "-t", name, "#{window_width}x#{window_height}")
+	output, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		return checkResult{"terminal size", false, fmt.Sprintf("failed to read probe size: %v", err)}
+	}
+
+	want := fmt.Sprintf("%dx%d", cfg.Size.Width, cfg.Size.Height)
+	got := strings.TrimSpace(string(output))
+	if got != want {
+		return checkResult{"terminal size", false, fmt.Sprintf("requested %s but got %s", want, got)}
+	}
+	return checkResult{"terminal size", true, got}
+}
+
+func checkPolicy(cfg config.Config) checkResult {
+	if cfg.Policy.File == "" {
+		return checkResult{"policy", true, "no policy file configured"}
+	}
+	if _, err := config.LoadPolicy(cfg.Policy.File); err != nil {
+		return checkResult{"policy", false, err.Error()}
+	}
+	return checkResult{"policy", true, cfg.Policy.File}
+}
+
+func checkTemplates(cfg config.Config) checkResult {
+	if cfg.Templates.File == "" {
+		return checkResult{"templates", true, "no templates file configured"}
+	}
+	templates, err := config.LoadTemplates(cfg.Templates.File)
+	if err != nil {
+		return checkResult{"templates", false, err.Error()}
+	}
+	return checkResult{"templates", true, fmt.Sprintf("%d templates in %s", len(templates), cfg.Templates.File)}
+}
+
+func checkMacros(cfg config.Config) checkResult {
+	if cfg.Macros.File == "" {
+		return checkResult{"macros", true, "no macros file configured"}
+	}
+	macros, err := config.LoadMacros(cfg.Macros.File)
+	if err != nil {
+		return checkResult{"macros", false, err.Error()}
+	}
+	return checkResult{"macros", true, fmt.Sprintf("%d macros in %s", len(macros), cfg.Macros.File)}
+}
+
+func checkSandbox(cfg config.Config) checkResult {
+	if len(cfg.Sandbox.AllowedDirs) == 0 {
+		return checkResult{"sandbox", true, "unrestricted"}
+	}
+	for _, dir := range cfg.Sandbox.AllowedDirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return checkResult{"sandbox", false, fmt.Sprintf("allowed directory %s does not exist", dir)}
+		}
+	}
+	return checkResult{"sandbox", true, strings.Join(cfg.Sandbox.AllowedDirs, ", ")}
+}
@@ -1,26 +1,113 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/lox/tmux-mcp-server/internal/server"
+	"github.com/lox/tmux-mcp-server/internal/config"
+	"github.com/lox/tmux-mcp-server/internal/tmux"
 )
 
+// subcommand is an entry point selected by the first command line argument
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"serve", "[flags]", "Run the MCP server (default)", runServe},
+		{"list", "[flags]", "List sessions on the server's tmux socket", runList},
+		{"attach", "[flags] <session>", "Attach to a session on the server's tmux socket", runAttach},
+		{"kill", "[flags] <session> | --all", "Kill one or all sessions on the server's tmux socket", runKill},
+		{"doctor", "[flags]", "Check tmux, socket, shell and policy setup", runDoctor},
+	}
+}
+
 func main() {
-	// Parse command line arguments
-	config := server.ParseArgs(os.Args[1:])
+	args := os.Args[1:]
 
-	// Create and configure the server
-	s, err := server.NewServer(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create server: %v\n", err)
-		os.Exit(1)
+	// Without a subcommand, behave as "serve" so existing invocations keep working
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "-help") {
+			printUsage()
+			os.Exit(0)
+		}
+		os.Exit(runServe(args))
+	}
+
+	for _, sub := range subcommands {
+		if sub.name == args[0] {
+			os.Exit(sub.run(args[1:]))
+		}
+	}
+
+	if args[0] == tmux.RecordCommand {
+		os.Exit(runRecordOutput(args[1:]))
+	}
+
+	if args[0] == "help" {
+		printUsage()
+		os.Exit(0)
 	}
 
-	// Start the server
-	if err := server.Serve(s); err != nil {
-		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
-		os.Exit(1)
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: tmux-mcp-server <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "An MCP server that lets AI agents drive terminal sessions through tmux.\n\nCommands:\n")
+	for _, sub := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", sub.name, sub.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun 'tmux-mcp-server <command> --help' for the flags of a command.\n")
+}
+
+// newFlagSet creates the FlagSet for a subcommand with the shared configuration flags
+func newFlagSet(name string) (*flag.FlagSet, *config.Loader) {
+	fs := flag.NewFlagSet("tmux-mcp-server "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, sub := range subcommands {
+			if sub.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: tmux-mcp-server %s %s\n\n%s.\n\nFlags:\n", sub.name, sub.args, sub.summary)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs, config.NewLoader(fs)
+}
+
+// parseConfig parses the subcommand flags and loads the merged configuration.
+// It returns a non-negative exit code when the command should stop.
+func parseConfig(fs *flag.FlagSet, loader *config.Loader, args []string) (config.Config, int) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return config.Config{}, 0
+		}
+		return config.Config{}, 2
+	}
+
+	cfg, err := loader.Load(os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cfg, 2
+	}
+
+	tmux.Configure(tmux.Config{
+		SocketName: cfg.Socket.Name,
+		SocketPath: cfg.Socket.Path,
+		Width:      cfg.Size.Width,
+		Height:     cfg.Size.Height,
+	})
+
+	return cfg, -1
 }
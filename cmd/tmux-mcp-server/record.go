@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+)
+
+// runRecordOutput is run by tmux pipe-pane for sessions with shell
+// integration. It isn't listed in the usage.
+func runRecordOutput(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: tmux-mcp-server %s <log>\n", tmux.RecordCommand)
+		return 2
+	}
+
+	if err := tmux.RecordOutput(os.Stdin, args[0], tmux.MaxOutputLog); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
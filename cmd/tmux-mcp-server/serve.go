@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lox/tmux-mcp-server/internal/server"
+)
+
+func runServe(args []string) int {
+	fs, loader := newFlagSet("serve")
+	printConfig := fs.Bool("print-config", false, "Print the effective configuration and exit")
+
+	cfg, code := parseConfig(fs, loader, args)
+	if code >= 0 {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		return 2
+	}
+
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		fmt.Print(out)
+		return 0
+	}
+
+	// The server and the transport share one logger, so a log file is
+	// opened once
+	logger, err := server.NewLogger(cfg.Log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create server: %v\n", err)
+		return 1
+	}
+
+	// Create and configure the server
+	s, err := server.NewServer(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create server: %v\n", err)
+		return 1
+	}
+
+	// Start the server
+	if err := server.Serve(s, cfg, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+)
+
+func runList(args []string) int {
+	fs, loader := newFlagSet("list")
+	if _, code := parseConfig(fs, loader, args); code >= 0 {
+		return code
+	}
+
+	names, err := tmux.ListSessionNames(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "No sessions on socket %s\n", tmux.SocketFile())
+		return 0
+	}
+
+	sessions, err := tmux.ListSessions(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Print(sessions)
+
+	return 0
+}
+
+func runAttach(args []string) int {
+	fs, loader := newFlagSet("attach")
+	if _, code := parseConfig(fs, loader, args); code >= 0 {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	tmuxPath, err := exec.LookPath("tmux")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tmux is required but not found in PATH\n")
+		return 1
+	}
+
+	// Replace this process with tmux so the terminal is handed over cleanly
+	argv := append([]string{"tmux"}, tmux.SocketArgs()...)
+	argv = append(argv, "attach-session", "-t", fs.Arg(0))
+	if err := syscall.Exec(tmuxPath, argv, os.Environ()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to attach: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func runKill(args []string) int {
+	fs, loader := newFlagSet("kill")
+	all := fs.Bool("all", false, "Kill every session on the socket")
+	force := fs.Bool("force", false, "Allow --all on the default tmux socket")
+
+	cfg, code := parseConfig(fs, loader, args)
+	if code >= 0 {
+		return code
+	}
+
+	if *all == (fs.NArg() == 1) || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if !*all {
+		if err := tmux.KillSession(context.Background(), fs.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to kill session '%s': %v\n", fs.Arg(0), err)
+			return 1
+		}
+		fmt.Printf("Killed session '%s'\n", fs.Arg(0))
+		return 0
+	}
+
+	if cfg.Socket.Name == "" && cfg.Socket.Path == "" && !*force {
+		fmt.Fprintf(os.Stderr, "Refusing to kill all sessions on the default tmux socket; configure a socket or pass --force\n")
+		return 2
+	}
+
+	names, err := tmux.ListSessionNames(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, name := range names {
+		if err := tmux.KillSession(context.Background(), name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to kill session '%s': %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Killed session '%s'\n", name)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
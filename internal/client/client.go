@@ -86,6 +86,19 @@ func (c *Client) SendKeys(ctx context.Context, sessionName, keys string) (*mcp.C
 	return c.mcpClient.CallTool(ctx, request)
 }
 
+// SendCommands sends a sequence of commands and special keys to a session
+func (c *Client) SendCommands(ctx context.Context, sessionName string, commands []string, captureScreen bool) (*mcp.CallToolResult, error) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "send_commands"
+	request.Params.Arguments = map[string]interface{}{
+		"session_name":   sessionName,
+		"commands":       commands,
+		"capture_screen": captureScreen,
+	}
+
+	return c.mcpClient.CallTool(ctx, request)
+}
+
 // ViewSession captures the current screen of a session
 func (c *Client) ViewSession(ctx context.Context, sessionName string) (*mcp.CallToolResult, error) {
 	request := mcp.CallToolRequest{}
@@ -117,6 +130,29 @@ func (c *Client) CloseSession(ctx context.Context, sessionName string) (*mcp.Cal
 	return c.mcpClient.CallTool(ctx, request)
 }
 
+// CallTool calls any tool by name with the given arguments
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	return c.CallToolWithProgress(ctx, name, args, nil)
+}
+
+// CallToolWithProgress calls a tool, asking the server for progress
+// notifications tagged with progressToken. Receive them with OnNotification.
+func (c *Client) CallToolWithProgress(ctx context.Context, name string, args map[string]interface{}, progressToken mcp.ProgressToken) (*mcp.CallToolResult, error) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = args
+	if progressToken != nil {
+		request.Params.Meta = &mcp.Meta{ProgressToken: progressToken}
+	}
+
+	return c.mcpClient.CallTool(ctx, request)
+}
+
+// OnNotification registers a handler for notifications sent by the server
+func (c *Client) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
+	c.mcpClient.OnNotification(handler)
+}
+
 // Close closes the client
 func (c *Client) Close() error {
 	return c.mcpClient.Close()
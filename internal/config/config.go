@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Transport names accepted in the configuration
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+)
+
+// Config holds the effective server configuration
+type Config struct {
+	Transport string          `yaml:"transport"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Socket    SocketConfig    `yaml:"socket"`
+	Sandbox   SandboxConfig   `yaml:"sandbox"`
+	Policy    PolicyConfig    `yaml:"policy"`
+	Templates TemplatesConfig `yaml:"templates"`
+	Macros    MacrosConfig    `yaml:"macros"`
+	Size      SizeConfig      `yaml:"size"`
+	Session   SessionConfig   `yaml:"session"`
+	Tools     ToolsConfig     `yaml:"tools"`
+	Log       LogConfig       `yaml:"log"`
+}
+
+// HTTPConfig configures the HTTP transport
+type HTTPConfig struct {
+	Port string `yaml:"port"`
+}
+
+// SocketConfig selects the tmux server socket, equivalent to tmux -L or -S
+type SocketConfig struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// SandboxConfig restricts where sessions may be started
+type SandboxConfig struct {
+	AllowedDirs []string `yaml:"allowed_dirs"`
+}
+
+// PolicyConfig points at a policy file of allowed and denied commands
+type PolicyConfig struct {
+	File string `yaml:"file"`
+}
+
+// TemplatesConfig locates the session templates file
+type TemplatesConfig struct {
+	File string `yaml:"file"`
+}
+
+// MacrosConfig locates the file user macros are saved to
+type MacrosConfig struct {
+	File string `yaml:"file"`
+}
+
+// SizeConfig holds the default terminal size for new sessions
+type SizeConfig struct {
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+}
+
+// SessionConfig sets defaults for new sessions
+type SessionConfig struct {
+	// Shell runs in new sessions instead of tmux's default shell
+	Shell string `yaml:"shell"`
+	// NamePrefix starts the names generated for sessions started without one
+	NamePrefix string `yaml:"name_prefix"`
+	// Env is set in every new session; start_session can override entries,
+	// and an empty value leaves a variable unset
+	Env map[string]string `yaml:"env"`
+}
+
+// ToolsConfig controls how tool calls are executed
+type ToolsConfig struct {
+	// Timeout bounds every tool call; zero disables it
+	Timeout time.Duration `yaml:"timeout"`
+	// Timeouts overrides Timeout for individual tools by name
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+}
+
+// TimeoutFor returns the timeout that applies to the named tool
+func (t ToolsConfig) TimeoutFor(tool string) time.Duration {
+	if d, ok := t.Timeouts[tool]; ok {
+		return d
+	}
+	return t.Timeout
+}
+
+// LogConfig controls server logging
+type LogConfig struct {
+	Level string `yaml:"level"`
+	File  string `yaml:"file"`
+}
+
+// Default returns the built-in configuration
+func Default() Config {
+	return Config{
+		Transport: TransportStdio,
+		HTTP:      HTTPConfig{Port: "8080"},
+		Size:      SizeConfig{Width: 80, Height: 24},
+		Session: SessionConfig{
+			NamePrefix: "agent",
+			Env: map[string]string{
+				"PAGER":     "cat",
+				"GIT_PAGER": "cat",
+				"NO_COLOR":  "1",
+			},
+		},
+		Tools: ToolsConfig{Timeout: 5 * time.Minute},
+		Log:   LogConfig{Level: "info"},
+	}
+}
+
+// LoadFile merges the YAML file at path over cfg
+func LoadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// ApplyEnv merges TMUX_MCP_* environment variables over cfg
+func ApplyEnv(cfg *Config, getenv func(string) string) error {
+	strVars := map[string]*string{
+		"TMUX_MCP_TRANSPORT":      &cfg.Transport,
+		"TMUX_MCP_PORT":           &cfg.HTTP.Port,
+		"TMUX_MCP_SOCKET_NAME":    &cfg.Socket.Name,
+		"TMUX_MCP_SOCKET_PATH":    &cfg.Socket.Path,
+		"TMUX_MCP_POLICY_FILE":    &cfg.Policy.File,
+		"TMUX_MCP_TEMPLATES_FILE": &cfg.Templates.File,
+		"TMUX_MCP_MACROS_FILE":    &cfg.Macros.File,
+		"TMUX_MCP_SHELL":          &cfg.Session.Shell,
+		"TMUX_MCP_SESSION_PREFIX": &cfg.Session.NamePrefix,
+		"TMUX_MCP_LOG_LEVEL":      &cfg.Log.Level,
+		"TMUX_MCP_LOG_FILE":       &cfg.Log.File,
+	}
+	for name, target := range strVars {
+		if v := getenv(name); v != "" {
+			*target = v
+		}
+	}
+
+	intVars := map[string]*int{
+		"TMUX_MCP_WIDTH":  &cfg.Size.Width,
+		"TMUX_MCP_HEIGHT": &cfg.Size.Height,
+	}
+	for name, target := range intVars {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not a number", name, v)
+			}
+			*target = n
+		}
+	}
+
+	if v := getenv("TMUX_MCP_TOOL_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid TMUX_MCP_TOOL_TIMEOUT: %q is not a duration", v)
+		}
+		cfg.Tools.Timeout = d
+	}
+
+	if v := getenv("TMUX_MCP_ALLOWED_DIRS"); v != "" {
+		cfg.Sandbox.AllowedDirs = filepath.SplitList(v)
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for errors, reporting all of them at once
+func (c Config) Validate() error {
+	var problems []string
+
+	switch c.Transport {
+	case TransportStdio, TransportHTTP:
+	default:
+		problems = append(problems, fmt.Sprintf("transport must be %q or %q, got %q", TransportStdio, TransportHTTP, c.Transport))
+	}
+
+	if c.Transport == TransportHTTP {
+		if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("http.port must be between 1 and 65535, got %q", c.HTTP.Port))
+		}
+	}
+
+	if c.Socket.Name != "" && c.Socket.Path != "" {
+		problems = append(problems, "socket.name and socket.path are mutually exclusive")
+	}
+
+	if c.Size.Width < 10 || c.Size.Height < 2 {
+		problems = append(problems, fmt.Sprintf("size must be at least 10x2, got %dx%d", c.Size.Width, c.Size.Height))
+	}
+
+	for _, dir := range c.Sandbox.AllowedDirs {
+		if !filepath.IsAbs(dir) {
+			problems = append(problems, fmt.Sprintf("sandbox.allowed_dirs entries must be absolute, got %q", dir))
+		}
+	}
+
+	if c.Session.NamePrefix == "" || strings.ContainsAny(c.Session.NamePrefix, ":. ") {
+		problems = append(problems, fmt.Sprintf("session.name_prefix must be non-empty without colons, dots or spaces, got %q", c.Session.NamePrefix))
+	}
+
+	for name := range c.Session.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			problems = append(problems, fmt.Sprintf("session.env names must be non-empty without = or spaces, got %q", name))
+		}
+	}
+
+	if c.Tools.Timeout < 0 {
+		problems = append(problems, fmt.Sprintf("tools.timeout must not be negative, got %v", c.Tools.Timeout))
+	}
+	for tool, d := range c.Tools.Timeouts {
+		if d < 0 {
+			problems = append(problems, fmt.Sprintf("tools.timeouts.%s must not be negative, got %v", tool, d))
+		}
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level must be one of debug, info, warn, error, got %q", c.Log.Level))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// YAML renders the configuration as YAML
+func (c Config) YAML() (string, error) {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %v", err)
+	}
+	return string(out), nil
+}
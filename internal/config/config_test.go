@@ -0,0 +1,199 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoaderPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+transport: http
+http:
+  port: "9000"
+size:
+  width: 120
+  height: 40
+log:
+  level: debug
+`), 0o600))
+
+	env := map[string]string{
+		"TMUX_MCP_CONFIG": path,
+		"TMUX_MCP_PORT":   "9100",
+		"TMUX_MCP_WIDTH":  "132",
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	require.NoError(t, fs.Parse([]string{"--port", "9200", "--socket-name", "agents"}))
+
+	cfg, err := loader.Load(func(k string) string { return env[k] })
+	require.NoError(t, err)
+
+	assert.Equal(t, TransportHTTP, cfg.Transport, "file overrides default")
+	assert.Equal(t, "9200", cfg.HTTP.Port, "flag overrides env and file")
+	assert.Equal(t, 132, cfg.Size.Width, "env overrides file")
+	assert.Equal(t, 40, cfg.Size.Height, "file value kept")
+	assert.Equal(t, "agents", cfg.Socket.Name)
+	assert.Equal(t, "debug", cfg.Log.Level)
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("transprt: http\n"), 0o600))
+
+	cfg := Default()
+	err := LoadFile(&cfg, path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "transprt")
+}
+
+func TestLoadFileMergesSessionEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+session:
+  shell: zsh
+  env:
+    NO_COLOR: ""
+    EDITOR: vi
+`), 0o600))
+
+	cfg := Default()
+	require.NoError(t, LoadFile(&cfg, path))
+
+	assert.Equal(t, "zsh", cfg.Session.Shell)
+	assert.Equal(t, map[string]string{"PAGER": "cat", "GIT_PAGER": "cat", "NO_COLOR": "", "EDITOR": "vi"}, cfg.Session.Env)
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := Default()
+	cfg.Transport = "carrier-pigeon"
+	cfg.Socket = SocketConfig{Name: "a", Path: "/tmp/b"}
+	cfg.Log.Level = "loud"
+	cfg.Session.NamePrefix = "my.agent"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "transport")
+	assert.Contains(t, err.Error(), "mutually exclusive")
+	assert.Contains(t, err.Error(), "log.level")
+	assert.Contains(t, err.Error(), "session.name_prefix")
+}
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+allow:
+  - "^(vim|git|go) "
+deny:
+  - "git push"
+`), 0o600))
+
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.CheckCommand("git status"))
+	assert.Error(t, policy.CheckCommand("git push origin main"))
+	assert.Error(t, policy.CheckCommand("rm -rf /"))
+}
+
+func TestSandboxCheckDir(t *testing.T) {
+	sandbox := SandboxConfig{AllowedDirs: []string{"/work"}}
+
+	assert.NoError(t, sandbox.CheckDir("/work"))
+	assert.NoError(t, sandbox.CheckDir("/work/project"))
+	assert.Error(t, sandbox.CheckDir("/workshop"))
+	assert.Error(t, sandbox.CheckDir("/etc"))
+}
+
+func TestLoadTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+templates:
+  dev:
+    working_directory: /work/app
+    windows:
+      - name: server
+        working_directory: cmd
+        panes:
+          - command: make run
+          - command: tail -f dev.log
+            working_directory: /var/log
+            split: horizontal
+      - name: shell
+`), 0o600))
+
+	templates, err := LoadTemplates(path)
+	require.NoError(t, err)
+	require.Contains(t, templates, "dev")
+
+	dev := templates["dev"]
+	assert.Equal(t, "/work/app/cmd", dev.PaneDir(0, 0))
+	assert.Equal(t, "/var/log", dev.PaneDir(0, 1))
+	assert.Equal(t, "/work/app", dev.PaneDir(1, 0))
+	assert.Len(t, dev.Windows[1].PaneList(), 1)
+}
+
+func TestLoadTemplatesReportsAllProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+templates:
+  empty: {}
+  bad:
+    windows:
+      - panes:
+          - split: diagonal
+            wait_for: "("
+`), 0o600))
+
+	_, err := LoadTemplates(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "empty: at least one window")
+	assert.Contains(t, err.Error(), "split must be horizontal or vertical")
+	assert.Contains(t, err.Error(), "wait_for")
+}
+
+func TestLoadMacros(t *testing.T) {
+	dir := t.TempDir()
+
+	macros, err := LoadMacros(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, macros)
+
+	path := filepath.Join(dir, "macros.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+macros:
+  greet:
+    description: Say hello
+    params:
+      - name: who
+        default: world
+    steps:
+      - echo hello {{who}}
+      - sleep: 500
+      - key: ENTER
+`), 0o600))
+
+	macros, err = LoadMacros(path)
+	require.NoError(t, err)
+	greet := macros["greet"]
+	assert.Equal(t, "world", *greet.Params[0].Default)
+	assert.Equal(t, []any{"echo hello {{who}}", map[string]any{"sleep": float64(500)}, map[string]any{"key": "ENTER"}}, greet.Steps, "numbers read as they would arrive in JSON")
+
+	saved := filepath.Join(dir, "saved.yaml")
+	require.NoError(t, SaveMacros(saved, macros))
+	reloaded, err := LoadMacros(saved)
+	require.NoError(t, err)
+	assert.Equal(t, macros, reloaded)
+
+	require.NoError(t, os.WriteFile(path, []byte("macros:\n  x:\n    stepz: []\n"), 0o600))
+	_, err = LoadMacros(path)
+	assert.Error(t, err, "unknown keys are rejected")
+}
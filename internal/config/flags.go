@@ -0,0 +1,116 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// Loader binds configuration flags to a FlagSet and produces the merged
+// configuration: defaults, then the config file, then TMUX_MCP_* environment
+// variables, then any flags given on the command line.
+type Loader struct {
+	fs         *flag.FlagSet
+	configPath string
+	flagCfg    Config
+	httpFlag   bool
+	allowed    stringList
+}
+
+// NewLoader registers the configuration flags on fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs}
+	defaults := Default()
+
+	fs.StringVar(&l.configPath, "config", "", "Path to a YAML config file (env TMUX_MCP_CONFIG)")
+	fs.StringVar(&l.flagCfg.Transport, "transport", defaults.Transport, "Transport to serve on: stdio or http")
+	fs.BoolVar(&l.httpFlag, "http", false, "Shorthand for --transport http")
+	fs.StringVar(&l.flagCfg.HTTP.Port, "port", defaults.HTTP.Port, "Port for the http transport")
+	fs.StringVar(&l.flagCfg.Socket.Name, "socket-name", "", "tmux socket name, as in tmux -L")
+	fs.StringVar(&l.flagCfg.Socket.Path, "socket-path", "", "tmux socket path, as in tmux -S")
+	fs.Var(&l.allowed, "allowed-dir", "Directory sessions may be started in (repeatable)")
+	fs.StringVar(&l.flagCfg.Policy.File, "policy", "", "Path to a command policy file")
+	fs.StringVar(&l.flagCfg.Templates.File, "templates", "", "Path to a session templates file")
+	fs.StringVar(&l.flagCfg.Macros.File, "macros", "", "Path to the file user macros are saved to")
+	fs.IntVar(&l.flagCfg.Size.Width, "width", defaults.Size.Width, "Default terminal width for new sessions")
+	fs.IntVar(&l.flagCfg.Size.Height, "height", defaults.Size.Height, "Default terminal height for new sessions")
+	fs.StringVar(&l.flagCfg.Session.Shell, "shell", "", "Shell to run in new sessions instead of tmux's default")
+	fs.StringVar(&l.flagCfg.Session.NamePrefix, "session-prefix", defaults.Session.NamePrefix, "Prefix of the names generated for sessions started without one")
+	fs.DurationVar(&l.flagCfg.Tools.Timeout, "tool-timeout", defaults.Tools.Timeout, "Maximum duration of a tool call (0 disables)")
+	fs.StringVar(&l.flagCfg.Log.Level, "log-level", defaults.Log.Level, "Log level: debug, info, warn or error")
+	fs.StringVar(&l.flagCfg.Log.File, "log-file", "", "Write logs to this file instead of stderr")
+
+	return l
+}
+
+// Load returns the merged and validated configuration. It must be called
+// after the FlagSet has been parsed.
+func (l *Loader) Load(getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	path := l.configPath
+	if path == "" {
+		path = getenv("TMUX_MCP_CONFIG")
+	}
+	if path != "" {
+		if err := LoadFile(&cfg, path); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := ApplyEnv(&cfg, getenv); err != nil {
+		return cfg, err
+	}
+
+	l.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "transport":
+			cfg.Transport = l.flagCfg.Transport
+		case "http":
+			if l.httpFlag {
+				cfg.Transport = TransportHTTP
+			}
+		case "port":
+			cfg.HTTP.Port = l.flagCfg.HTTP.Port
+		case "socket-name":
+			cfg.Socket.Name = l.flagCfg.Socket.Name
+		case "socket-path":
+			cfg.Socket.Path = l.flagCfg.Socket.Path
+		case "allowed-dir":
+			cfg.Sandbox.AllowedDirs = l.allowed
+		case "policy":
+			cfg.Policy.File = l.flagCfg.Policy.File
+		case "templates":
+			cfg.Templates.File = l.flagCfg.Templates.File
+		case "macros":
+			cfg.Macros.File = l.flagCfg.Macros.File
+		case "width":
+			cfg.Size.Width = l.flagCfg.Size.Width
+		case "height":
+			cfg.Size.Height = l.flagCfg.Size.Height
+		case "shell":
+			cfg.Session.Shell = l.flagCfg.Session.Shell
+		case "session-prefix":
+			cfg.Session.NamePrefix = l.flagCfg.Session.NamePrefix
+		case "tool-timeout":
+			cfg.Tools.Timeout = l.flagCfg.Tools.Timeout
+		case "log-level":
+			cfg.Log.Level = l.flagCfg.Log.Level
+		case "log-file":
+			cfg.Log.File = l.flagCfg.Log.File
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
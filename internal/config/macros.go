@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Macro is a named, parameterised sequence of send_commands steps
+type Macro struct {
+	Description string       `yaml:"description,omitempty"`
+	Params      []MacroParam `yaml:"params,omitempty"`
+	// Steps are send_commands steps as given, with {{param}} placeholders in
+	// their text
+	Steps []any `yaml:"steps"`
+}
+
+// MacroParam is a macro parameter; it is required unless it has a default
+type MacroParam struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description,omitempty"`
+	Default     *string `yaml:"default,omitempty"`
+}
+
+// macrosFile is the on-disk format of a macros file
+type macrosFile struct {
+	Macros map[string]Macro `yaml:"macros"`
+}
+
+// LoadMacros reads the macros file at path. A missing file or an empty path
+// yields no macros, since the file is created when the first macro is saved.
+// Steps are checked by the server, which knows the step syntax.
+func LoadMacros(path string) (map[string]Macro, error) {
+	macros := map[string]Macro{}
+	if path == "" {
+		return macros, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return macros, nil
+		}
+		return nil, fmt.Errorf("failed to read macros file: %v", err)
+	}
+
+	var file macrosFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse macros file %s: %v", path, err)
+	}
+
+	for name, macro := range file.Macros {
+		for i, step := range macro.Steps {
+			macro.Steps[i] = jsonNumbers(step)
+		}
+		macros[name] = macro
+	}
+	return macros, nil
+}
+
+// jsonNumbers converts the integers YAML decodes into the float64s that step
+// objects carry when they arrive as JSON, e.g. {sleep: 500}
+func jsonNumbers(step any) any {
+	obj, ok := step.(map[string]any)
+	if !ok {
+		return step
+	}
+	for key, value := range obj {
+		if n, ok := value.(int); ok {
+			obj[key] = float64(n)
+		}
+	}
+	return obj
+}
+
+// SaveMacros writes macros to the file at path, replacing it atomically
+func SaveMacros(path string, macros map[string]Macro) error {
+	data, err := yaml.Marshal(macrosFile{Macros: macros})
+	if err != nil {
+		return fmt.Errorf("failed to encode macros: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".macros-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to save macros: %v", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save macros: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save macros: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save macros: %v", err)
+	}
+	return nil
+}
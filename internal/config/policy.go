@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy decides which commands agents may run or type into sessions
+type Policy struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// policyFile is the on-disk format of a policy file
+type policyFile struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// LoadPolicy reads and compiles the policy file at path. An empty path yields
+// a policy that allows everything.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return &Policy{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	var file policyFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy file %s: %v", path, err)
+	}
+
+	policy := &Policy{}
+	if policy.allow, err = compilePatterns("allow", file.Allow); err != nil {
+		return nil, fmt.Errorf("policy file %s: %v", path, err)
+	}
+	if policy.deny, err = compilePatterns("deny", file.Deny); err != nil {
+		return nil, fmt.Errorf("policy file %s: %v", path, err)
+	}
+
+	return policy, nil
+}
+
+func compilePatterns(kind string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d] %q is not a valid regular expression: %v", kind, i, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// CheckCommand returns an error if the policy forbids the given command text.
+// Deny rules win over allow rules; when allow rules exist, a command must
+// match at least one of them.
+func (p *Policy) CheckCommand(command string) error {
+	if p == nil || command == "" {
+		return nil
+	}
+
+	for _, re := range p.deny {
+		if re.MatchString(command) {
+			return fmt.Errorf("command %q is denied by policy rule /%s/", command, re.String())
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return nil
+	}
+
+	for _, re := range p.allow {
+		if re.MatchString(command) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("command %q is not allowed by policy", command)
+}
+
+// CheckDir returns an error if dir is outside the sandbox's allowed directories
+func (s SandboxConfig) CheckDir(dir string) error {
+	if len(s.AllowedDirs) == 0 || dir == "" {
+		return nil
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid working directory %q: %v", dir, err)
+	}
+
+	for _, allowed := range s.AllowedDirs {
+		rel, err := filepath.Rel(allowed, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("working directory %q is outside the sandbox (allowed: %s)", dir, strings.Join(s.AllowedDirs, ", "))
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTemplateWait bounds a pane's wait_for when it sets no wait_timeout
+const DefaultTemplateWait = 30 * time.Second
+
+// Template describes a session to create: its windows, their panes and what
+// runs in each
+type Template struct {
+	Description string `yaml:"description"`
+	// WorkingDir is the session's directory; relative pane and window
+	// directories are resolved against it
+	WorkingDir string `yaml:"working_directory"`
+	Shell      string `yaml:"shell"`
+	// Env is merged over session.env; an empty value leaves a variable unset
+	Env     map[string]string `yaml:"env"`
+	Windows []TemplateWindow  `yaml:"windows"`
+}
+
+// TemplateWindow is one window of a template
+type TemplateWindow struct {
+	Name       string `yaml:"name"`
+	WorkingDir string `yaml:"working_directory"`
+	// Layout is a tmux layout such as tiled or main-vertical, applied once
+	// all the panes exist
+	Layout string         `yaml:"layout"`
+	Panes  []TemplatePane `yaml:"panes"`
+}
+
+// TemplatePane is one pane of a template window. Every pane after the first
+// is split from the one before it.
+type TemplatePane struct {
+	// Command is typed into the pane's shell followed by Enter
+	Command    string            `yaml:"command"`
+	WorkingDir string            `yaml:"working_directory"`
+	Env        map[string]string `yaml:"env"`
+	// Split is horizontal (side by side) or vertical (stacked, the default)
+	Split string `yaml:"split"`
+	// Size is the pane's share of the pane it was split from, in percent
+	Size int `yaml:"size"`
+	// WaitFor is a regular expression; the next pane isn't started until it
+	// appears in this one
+	WaitFor     string        `yaml:"wait_for"`
+	WaitTimeout time.Duration `yaml:"wait_timeout"`
+}
+
+// templatesFile is the on-disk format of a templates file
+type templatesFile struct {
+	Templates map[string]Template `yaml:"templates"`
+}
+
+// LoadTemplates reads and validates the templates file at path. An empty path
+// yields no templates.
+func LoadTemplates(path string) (map[string]Template, error) {
+	if path == "" {
+		return map[string]Template{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates file: %v", err)
+	}
+
+	var file templatesFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse templates file %s: %v", path, err)
+	}
+
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(file.Templates)) {
+		for _, problem := range file.Templates[name].validate() {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid templates file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+
+	if file.Templates == nil {
+		file.Templates = map[string]Template{}
+	}
+	return file.Templates, nil
+}
+
+// PaneDir returns the working directory of a pane: the pane's own, else its
+// window's, else the template's, with relative directories resolved against
+// the level above
+func (t Template) PaneDir(window, pane int) string {
+	dir := t.WorkingDir
+	w := t.Windows[window]
+	for _, d := range []string{w.WorkingDir, w.PaneList()[pane].WorkingDir} {
+		switch {
+		case d == "":
+		case filepath.IsAbs(d) || dir == "":
+			dir = d
+		default:
+			dir = filepath.Join(dir, d)
+		}
+	}
+	return dir
+}
+
+// PaneList returns the panes of a window; a window that lists none has a
+// single pane running the shell
+func (w TemplateWindow) PaneList() []TemplatePane {
+	if len(w.Panes) == 0 {
+		return []TemplatePane{{}}
+	}
+	return w.Panes
+}
+
+// validate reports every problem with the template
+func (t Template) validate() []string {
+	var problems []string
+
+	if len(t.Windows) == 0 {
+		problems = append(problems, "at least one window is required")
+	}
+	for i, w := range t.Windows {
+		for j, p := range w.Panes {
+			where := fmt.Sprintf("windows[%d].panes[%d]", i, j)
+			switch p.Split {
+			case "", "horizontal", "vertical":
+			default:
+				problems = append(problems, fmt.Sprintf("%s.split must be horizontal or vertical, got %q", where, p.Split))
+			}
+			if p.Size < 0 || p.Size > 99 {
+				problems = append(problems, fmt.Sprintf("%s.size must be a percentage between 1 and 99, got %d", where, p.Size))
+			}
+			if p.WaitFor != "" {
+				if _, err := regexp.Compile(p.WaitFor); err != nil {
+					problems = append(problems, fmt.Sprintf("%s.wait_for %q is not a valid regular expression: %v", where, p.WaitFor, err))
+				}
+			}
+			if p.WaitTimeout < 0 {
+				problems = append(problems, fmt.Sprintf("%s.wait_timeout must not be negative, got %v", where, p.WaitTimeout))
+			}
+		}
+	}
+
+	return problems
+}
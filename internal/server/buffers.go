@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func registerBufferTools(s *server.MCPServer, h *handler) {
+	// set_buffer tool
+	setBufferTool := mcp.NewTool("set_buffer",
+		mcp.WithDescription("Store text in a tmux paste buffer, ready to paste into a session with paste_buffer. Much faster than typing large blocks of text."),
+		mcp.WithString("buffer_name",
+			mcp.Required(),
+			mcp.Description("Name of the buffer to create or replace"),
+		),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Text to store in the buffer, exactly as it should be pasted"),
+		),
+	)
+	s.AddTool(setBufferTool, h.setBufferHandler)
+
+	// paste_buffer tool
+	pasteBufferTool := mcp.NewTool("paste_buffer",
+		mcp.WithDescription("Paste a tmux buffer into a terminal session"),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithString("buffer_name",
+			mcp.Required(),
+			mcp.Description("Name of the buffer to paste"),
+		),
+		mcp.WithBoolean("bracketed",
+			mcp.Description("Use bracketed paste when the application supports it, so editors and REPLs don't auto-indent or run lines early (default: true)"),
+		),
+		mcp.WithBoolean("delete_after",
+			mcp.Description("Delete the buffer after pasting (default: false)"),
+		),
+	)
+	s.AddTool(pasteBufferTool, h.pasteBufferHandler)
+
+	// list_buffers tool
+	listBuffersTool := mcp.NewTool("list_buffers",
+		mcp.WithDescription("List tmux paste buffers with their sizes and a preview"),
+	)
+	s.AddTool(listBuffersTool, h.listBuffersHandler)
+
+	// get_buffer tool
+	getBufferTool := mcp.NewTool("get_buffer",
+		mcp.WithDescription("Return the full content of a tmux paste buffer"),
+		mcp.WithString("buffer_name",
+			mcp.Required(),
+			mcp.Description("Name of the buffer"),
+		),
+	)
+	s.AddTool(getBufferTool, h.getBufferHandler)
+}
+
+func (h *handler) setBufferHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	bufferName, err := request.RequireString("buffer_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	content, err := request.RequireString("content")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Pasted text reaches the shell just like typed text
+	if err := h.policy.CheckCommand(content); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := tmux.SetBuffer(ctx, bufferName, content); err != nil {
+		return toolError("Failed to set buffer", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Buffer '%s' set (%d bytes)", bufferName, len(content))), nil
+}
+
+func (h *handler) pasteBufferHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	bufferName, err := request.RequireString("buffer_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	err = tmux.PasteBuffer(ctx, sessionName, bufferName, tmux.PasteOptions{
+		Bracketed: request.GetBool("bracketed", true),
+		Delete:    request.GetBool("delete_after", false),
+	})
+	if err != nil {
+		return toolError("Failed to paste buffer", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Buffer '%s' pasted into session '%s'", bufferName, sessionName)), nil
+}
+
+func (h *handler) listBuffersHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	buffers, err := tmux.ListBuffers(ctx)
+	if err != nil {
+		return toolError("Failed to list buffers", err), nil
+	}
+
+	if len(buffers) == 0 {
+		return mcp.NewToolResultText("No buffers"), nil
+	}
+
+	var b strings.Builder
+	for _, buffer := range buffers {
+		b.WriteString(fmt.Sprintf("%s: %d bytes: %s\n", buffer.Name, buffer.Size, buffer.Sample))
+	}
+
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+func (h *handler) getBufferHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	bufferName, err := request.RequireString("buffer_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	content, err := tmux.GetBuffer(ctx, bufferName)
+	if err != nil {
+		return toolError("Failed to get buffer", err), nil
+	}
+
+	return mcp.NewToolResultText(content), nil
+}
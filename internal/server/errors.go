@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// errorHints tells agents what to do next for each error code
+var errorHints = map[string]string{
+	tmux.CodeSessionNotFound:    "Check the name with list_sessions or create it with start_session.",
+	tmux.CodeTargetNotFound:     "Check the window or pane index exists in the session.",
+	tmux.CodeDuplicateSession:   "Choose a different session_name, omit it to have one generated, or set if_exists to reuse, replace or suffix.",
+	tmux.CodeNoServer:           "No sessions exist yet; create one with start_session.",
+	tmux.CodeBufferNotFound:     "Check the buffer name with list_buffers.",
+	tmux.CodeUnsupported:        "Upgrade tmux or avoid this option.",
+	tmux.CodeMouseDisabled:      "Enable mouse support in the application (for example F2 setup in htop, or set mouse in vim) or use keys instead.",
+	tmux.CodeNoShellIntegration: "Start the session with shell_integration enabled to record command history.",
+	tmux.CodeConditionNotMet:    "Check the screen with view_session, then adjust the pattern or raise the limit.",
+	tmux.CodeInvalidSteps:       "Fix the listed steps and retry; use validate_only to check a sequence without sending it.",
+	tmux.CodeTimeout:            "The tool call hit its timeout; split the work into shorter calls.",
+	tmux.CodeCancelled:          "The request was cancelled; check the screen before retrying.",
+}
+
+// toolError builds an error result for a failed tmux operation, carrying a
+// machine-readable code in the result metadata and an actionable hint
+func toolError(action string, err error) *mcp.CallToolResult {
+	code := tmux.ErrorCode(err)
+
+	msg := fmt.Sprintf("%s: %v.", action, err)
+	if hint, ok := errorHints[code]; ok {
+		msg += " " + hint
+	}
+	msg += fmt.Sprintf(" (error_code: %s)", code)
+
+	result := mcp.NewToolResultError(msg)
+	result.Meta = map[string]any{"error_code": code}
+	return result
+}
+
+// invalidStepsError reports unparseable send_commands steps, listing each
+// problem in the result metadata as well as the text
+func invalidStepsError(err error) *mcp.CallToolResult {
+	result := toolError("Failed to send commands", err)
+
+	var stepsErr *tmux.StepsError
+	if errors.As(err, &stepsErr) {
+		problems := make([]map[string]any, len(stepsErr.Problems))
+		for i, p := range stepsErr.Problems {
+			problems[i] = map[string]any{"step": p.Index, "error": p.Err.Error()}
+		}
+		result.Meta["invalid_steps"] = problems
+	}
+
+	return result
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func registerExpectTools(s *server.MCPServer, h *handler) {
+	// expect tool
+	expectTool := mcp.NewTool("expect",
+		mcp.WithDescription("Run an expect-style dialogue: wait for prompts in a terminal session and answer each with the response of the first rule whose pattern appears, until the end pattern appears. Returns the transcript of prompts and responses."),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithArray("rules",
+			mcp.Required(),
+			mcp.Description("Prompts to answer. pattern is a regular expression matched against new output; send is text typed followed by Enter, or an array of send_commands steps sent as-is; timeout_ms is how long to wait for the next prompt after answering this one."),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern":    map[string]any{"type": "string"},
+					"send":       map[string]any{"type": []string{"string", "array"}},
+					"timeout_ms": map[string]any{"type": "number"},
+				},
+				"required": []string{"pattern", "send"},
+			}),
+		),
+		mcp.WithString("end_pattern",
+			mcp.Required(),
+			mcp.Description("Regular expression that finishes the dialogue successfully, e.g. the shell prompt"),
+		),
+		mcp.WithString("command",
+			mcp.Description("Command to type, followed by Enter, before waiting for the first prompt"),
+		),
+		mcp.WithNumber("timeout_ms",
+			mcp.Description("How long to wait for each prompt (default: 30000)"),
+		),
+		mcp.WithNumber("max_responses",
+			mcp.Description(fmt.Sprintf("Stop after answering this many prompts (default: %d)", tmux.DefaultMaxResponses)),
+		),
+	)
+	s.AddTool(expectTool, h.expectHandler)
+}
+
+func (h *handler) expectHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	endPattern, err := request.RequireString("end_pattern")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	end, err := tmux.NewCondition(endPattern)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	items, ok := request.GetArguments()["rules"].([]any)
+	if !ok {
+		return mcp.NewToolResultError("required argument \"rules\" must be an array"), nil
+	}
+
+	rules := make([]tmux.ExpectRule, len(items))
+	for i, item := range items {
+		rule, err := parseExpectRule(item)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("rule %d: %v", i+1, err)), nil
+		}
+		if err := h.checkSteps(rule.Send); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("rule %d: %v", i+1, err)), nil
+		}
+		rules[i] = rule
+	}
+
+	opts := tmux.ExpectOptions{
+		End:          end,
+		Timeout:      time.Duration(request.GetFloat("timeout_ms", 30000)) * time.Millisecond,
+		MaxResponses: request.GetInt("max_responses", tmux.DefaultMaxResponses),
+	}
+	if opts.Timeout <= 0 {
+		return mcp.NewToolResultError("timeout_ms must be positive"), nil
+	}
+	if opts.MaxResponses < 1 {
+		return mcp.NewToolResultError("max_responses must be at least 1"), nil
+	}
+	if command := request.GetString("command", ""); command != "" {
+		if err := h.policy.CheckCommand(command); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		opts.Start = lineSteps(command)
+	}
+
+	result, err := tmux.Expect(ctx, sessionName, rules, opts)
+	if err != nil {
+		res := toolError("Expect failed", err)
+		if len(result.Events) > 0 || result.Screen != "" {
+			res.Content = append(res.Content, mcp.NewTextContent(formatExpectResult(result)))
+		}
+		return res, nil
+	}
+
+	return mcp.NewToolResultText(formatExpectResult(result)), nil
+}
+
+// parseExpectRule parses one {pattern, send, timeout_ms} rule
+func parseExpectRule(item any) (tmux.ExpectRule, error) {
+	obj, ok := item.(map[string]any)
+	if !ok {
+		return tmux.ExpectRule{}, fmt.Errorf("must be an object with pattern and send")
+	}
+
+	pattern, ok := obj["pattern"].(string)
+	if !ok || pattern == "" {
+		return tmux.ExpectRule{}, fmt.Errorf("pattern must be a non-empty string")
+	}
+	cond, err := tmux.NewCondition(pattern)
+	if err != nil {
+		return tmux.ExpectRule{}, err
+	}
+
+	rule := tmux.ExpectRule{Pattern: cond}
+
+	switch send := obj["send"].(type) {
+	case string:
+		rule.Send = lineSteps(send)
+	case []any:
+		if rule.Send, err = tmux.ParseSteps(send); err != nil {
+			return tmux.ExpectRule{}, err
+		}
+	default:
+		return tmux.ExpectRule{}, fmt.Errorf("send must be a string or an array of steps")
+	}
+	if err := tmux.ValidateResponse(rule.Send); err != nil {
+		return tmux.ExpectRule{}, err
+	}
+
+	if ms, ok := obj["timeout_ms"].(float64); ok {
+		rule.Timeout = time.Duration(ms) * time.Millisecond
+		if rule.Timeout <= 0 {
+			return tmux.ExpectRule{}, fmt.Errorf("timeout_ms must be positive")
+		}
+	}
+
+	return rule, nil
+}
+
+// lineSteps types text literally and presses Enter
+func lineSteps(text string) []tmux.Step {
+	enter, _ := tmux.ParseKey("ENTER")
+	return []tmux.Step{
+		{Kind: tmux.StepText, Text: text},
+		{Kind: tmux.StepKey, Key: enter},
+	}
+}
+
+// formatExpectResult renders the transcript and final screen
+func formatExpectResult(result tmux.ExpectResult) string {
+	var b strings.Builder
+
+	if result.Ended {
+		b.WriteString(fmt.Sprintf("Dialogue finished in %s after %d responses.\n", result.Elapsed.Round(time.Millisecond), len(result.Events)))
+	} else {
+		b.WriteString(fmt.Sprintf("Dialogue stopped after %d responses.\n", len(result.Events)))
+	}
+
+	if transcript := result.Transcript(); transcript != "" {
+		b.WriteString("\nTranscript:\n")
+		b.WriteString(transcript)
+	}
+
+	if result.Screen != "" {
+		b.WriteString("\nScreen content:\n")
+		b.WriteString(result.Screen)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func registerHistoryTools(s *server.MCPServer, h *handler) {
+	// command_history tool
+	commandHistoryTool := mcp.NewTool("command_history",
+		mcp.WithDescription("List the commands run in a session started with shell_integration, with each command's working directory, exit code and output"),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Number of most recent commands to return (default: 10)"),
+		),
+		mcp.WithNumber("output_lines",
+			mcp.Description("Show at most this many trailing lines of each command's output, 0 to omit output (default: 20)"),
+		),
+	)
+	s.AddTool(commandHistoryTool, h.commandHistoryHandler)
+}
+
+func (h *handler) commandHistoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	limit := request.GetInt("limit", 10)
+	outputLines := request.GetInt("output_lines", 20)
+	if limit < 1 || outputLines < 0 {
+		return mcp.NewToolResultError("limit must be at least 1 and output_lines cannot be negative"), nil
+	}
+
+	records, err := tmux.CommandHistory(sessionName, limit)
+	if err != nil {
+		return toolError("Failed to read command history", err), nil
+	}
+
+	if len(records) == 0 {
+		return mcp.NewToolResultText("No commands have run yet"), nil
+	}
+
+	return mcp.NewToolResultText(formatCommandHistory(records, outputLines)), nil
+}
+
+// formatCommandHistory renders one header line per command, followed by
+// the tail of its output indented
+func formatCommandHistory(records []tmux.CommandRecord, outputLines int) string {
+	var b strings.Builder
+
+	for i, record := range records {
+		status := "running"
+		if record.Finished {
+			status = fmt.Sprintf("exit %d", record.ExitCode)
+		}
+		b.WriteString(fmt.Sprintf("%d. [%s] %s$ %s\n", i+1, status, record.Cwd, record.Command))
+
+		if outputLines == 0 || record.Output == "" {
+			continue
+		}
+		lines := strings.Split(record.Output, "\n")
+		if len(lines) > outputLines {
+			b.WriteString(fmt.Sprintf("   ... %d earlier lines\n", len(lines)-outputLines))
+			lines = lines[len(lines)-outputLines:]
+		}
+		for _, line := range lines {
+			b.WriteString("   " + line + "\n")
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,445 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/tmux-mcp-server/internal/config"
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// placeholderPattern matches {{name}} in step text
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// macroNamePattern restricts macro names
+var macroNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// paramNamePattern restricts parameter names to what placeholders accept
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinMacros are always available and cannot be redefined
+var builtinMacros = map[string]config.Macro{
+	"vim_save_quit": {
+		Description: "Save the file and quit vim",
+		Steps:       []any{"<ESCAPE>", ":wq", "<ENTER>"},
+	},
+	"vim_quit_discard": {
+		Description: "Quit vim, discarding unsaved changes",
+		Steps:       []any{"<ESCAPE>", ":q!", "<ENTER>"},
+	},
+	"vim_open": {
+		Description: "Open a file in the running vim",
+		Params:      []config.MacroParam{{Name: "file", Description: "Path of the file"}},
+		Steps:       []any{"<ESCAPE>", ":e {{file}}", "<ENTER>"},
+	},
+	"vim_goto_line": {
+		Description: "Move the cursor to a line in vim",
+		Params:      []config.MacroParam{{Name: "line", Description: "Line number"}},
+		Steps:       []any{"<ESCAPE>", ":{{line}}", "<ENTER>"},
+	},
+	"nano_save_exit": {
+		Description: "Save the file and exit nano",
+		Steps:       []any{"<CTRL+o>", "<ENTER>", "<CTRL+x>"},
+	},
+	"emacs_save_quit": {
+		Description: "Save the buffer and quit emacs",
+		Steps:       []any{"<CTRL+x>", "<CTRL+s>", "<CTRL+x>", "<CTRL+c>"},
+	},
+	"git_status_diff": {
+		Description: "Show git status and a summary of unstaged changes",
+		Steps:       []any{"git --no-pager status --short && git --no-pager diff --stat", "<ENTER>"},
+	},
+	"python_exit": {
+		Description: "Leave a Python REPL",
+		Steps:       []any{"exit()", "<ENTER>"},
+	},
+	"node_exit": {
+		Description: "Leave a Node.js REPL",
+		Steps:       []any{".exit", "<ENTER>"},
+	},
+	"repl_eval": {
+		Description: "Type an expression into a REPL and wait for the output to settle",
+		Params:      []config.MacroParam{{Name: "expr", Description: "Expression to evaluate"}},
+		Steps:       []any{"{{expr}}", "<ENTER>", "<WAIT_IDLE 300ms max=10s>"},
+	},
+}
+
+// macroStore holds the user's macros and saves them to a file, if one is
+// configured
+type macroStore struct {
+	mu     sync.Mutex
+	file   string
+	macros map[string]config.Macro
+}
+
+// loadMacros reads the macros file at path and checks every macro in it. A
+// missing file or an empty path yields an empty store.
+func loadMacros(path string) (*macroStore, error) {
+	macros, err := config.LoadMacros(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(macros)) {
+		if _, ok := builtinMacros[name]; ok {
+			return nil, fmt.Errorf("macros file %s: %s is a built-in macro and cannot be redefined", path, name)
+		}
+		if err := validateMacro(name, macros[name]); err != nil {
+			return nil, fmt.Errorf("macros file %s: %v", path, err)
+		}
+	}
+
+	return &macroStore{file: path, macros: macros}, nil
+}
+
+// get returns a built-in or user macro
+func (s *macroStore) get(name string) (config.Macro, bool) {
+	if macro, ok := builtinMacros[name]; ok {
+		return macro, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	macro, ok := s.macros[name]
+	return macro, ok
+}
+
+// define adds or replaces a user macro and saves the store
+func (s *macroStore) define(name string, macro config.Macro) error {
+	if _, ok := builtinMacros[name]; ok {
+		return fmt.Errorf("%s is a built-in macro and cannot be redefined", name)
+	}
+	if err := validateMacro(name, macro); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.macros[name]
+	s.macros[name] = macro
+	if s.file == "" {
+		return nil
+	}
+	if err := config.SaveMacros(s.file, s.macros); err != nil {
+		if existed {
+			s.macros[name] = previous
+		} else {
+			delete(s.macros, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// all returns a copy of the user macros
+func (s *macroStore) all() map[string]config.Macro {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.macros)
+}
+
+// validateMacro checks that a macro's steps parse and that every
+// placeholder names a parameter and sits in text that is typed, the only
+// place arguments are substituted
+func validateMacro(name string, macro config.Macro) error {
+	if !macroNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid macro name %q: use letters, digits, _, . and -", name)
+	}
+	if len(macro.Steps) == 0 {
+		return fmt.Errorf("macro %s has no steps", name)
+	}
+
+	params := map[string]bool{}
+	for _, p := range macro.Params {
+		if !paramNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("macro %s: invalid parameter name %q", name, p.Name)
+		}
+		if params[p.Name] {
+			return fmt.Errorf("macro %s: parameter %s is declared twice", name, p.Name)
+		}
+		params[p.Name] = true
+	}
+
+	steps, err := tmux.ParseSteps(macro.Steps)
+	if err != nil {
+		return fmt.Errorf("macro %s: %w", name, err)
+	}
+	for i, step := range steps {
+		if step.Kind != tmux.StepText && step.Kind != tmux.StepTypeSlow {
+			if m := placeholderPattern.FindStringSubmatch(stepSource(macro.Steps[i])); m != nil {
+				return fmt.Errorf("macro %s: step %d uses {{%s}} in a %s step; placeholders are only filled in text that is typed", name, i+1, m[1], step)
+			}
+			continue
+		}
+		for _, m := range placeholderPattern.FindAllStringSubmatch(step.Text, -1) {
+			if !params[m[1]] {
+				return fmt.Errorf("macro %s: step %d uses {{%s}}, which is not a parameter", name, i+1, m[1])
+			}
+		}
+	}
+
+	return nil
+}
+
+// stepSource returns the strings a step was written with, for finding
+// placeholders in steps of any form
+func stepSource(item any) string {
+	switch v := item.(type) {
+	case string:
+		return v
+	case map[string]any:
+		var values []string
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return strings.Join(values, " ")
+	}
+	return ""
+}
+
+// expandMacro parses the macro's steps and substitutes the arguments into
+// their text. Arguments are always typed literally, so they cannot inject
+// keys.
+func expandMacro(m config.Macro, args map[string]string) ([]tmux.Step, error) {
+	values := map[string]string{}
+	for _, p := range m.Params {
+		value, ok := args[p.Name]
+		switch {
+		case ok:
+		case p.Default != nil:
+			value = *p.Default
+		default:
+			return nil, fmt.Errorf("missing argument %s", p.Name)
+		}
+		values[p.Name] = value
+	}
+	for name := range args {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("unknown argument %s", name)
+		}
+	}
+
+	steps, err := tmux.ParseSteps(m.Steps)
+	if err != nil {
+		return nil, err
+	}
+	for i := range steps {
+		steps[i].Text = placeholderPattern.ReplaceAllStringFunc(steps[i].Text, func(match string) string {
+			return values[placeholderPattern.FindStringSubmatch(match)[1]]
+		})
+	}
+	return steps, nil
+}
+
+// macroUsage renders the macro's name and parameters, e.g. vim_open(file)
+func macroUsage(name string, m config.Macro) string {
+	params := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		params[i] = p.Name
+		if p.Default != nil {
+			params[i] += "=" + *p.Default
+		}
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func registerMacroTools(s *server.MCPServer, h *handler) {
+	// define_macro tool
+	defineMacroTool := mcp.NewTool("define_macro",
+		mcp.WithDescription("Define a reusable macro: a named sequence of send_commands steps with {{param}} placeholders in their text. Macros are saved if the server has a macros file."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the macro, e.g. restart_server"),
+		),
+		mcp.WithArray("steps",
+			mcp.Required(),
+			mcp.Description("Steps in send_commands form, e.g. [\"git commit -m '{{message}}'\", \"<ENTER>\"]"),
+		),
+		mcp.WithArray("params",
+			mcp.Description("Parameters used as {{name}} in the steps; a parameter without a default is required"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":        map[string]any{"type": "string"},
+					"description": map[string]any{"type": "string"},
+					"default":     map[string]any{"type": "string"},
+				},
+				"required": []string{"name"},
+			}),
+		),
+		mcp.WithString("description",
+			mcp.Description("What the macro does"),
+		),
+	)
+	s.AddTool(defineMacroTool, h.defineMacroHandler)
+
+	// run_macro tool
+	runMacroTool := mcp.NewTool("run_macro",
+		mcp.WithDescription("Run a macro in a terminal session, substituting the arguments into its steps"),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the macro, as shown by list_macros"),
+		),
+		mcp.WithObject("args",
+			mcp.Description("Values for the macro's parameters"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Show the expanded steps without sending them"),
+		),
+		mcp.WithBoolean("capture_screen",
+			mcp.Description("Include the screen content after running (default: true)"),
+		),
+	)
+	s.AddTool(runMacroTool, h.runMacroHandler)
+
+	// list_macros tool
+	listMacrosTool := mcp.NewTool("list_macros",
+		mcp.WithDescription("List the built-in and user-defined macros with their parameters and steps"),
+	)
+	s.AddTool(listMacrosTool, h.listMacrosHandler)
+}
+
+func (h *handler) defineMacroHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	steps, ok := request.GetArguments()["steps"].([]any)
+	if !ok {
+		return mcp.NewToolResultError("required argument \"steps\" must be an array"), nil
+	}
+	macro := config.Macro{Description: request.GetString("description", ""), Steps: steps}
+
+	if items, ok := request.GetArguments()["params"].([]any); ok {
+		for i, item := range items {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("params[%d] must be an object with a name", i)), nil
+			}
+			param := config.MacroParam{}
+			param.Name, _ = obj["name"].(string)
+			param.Description, _ = obj["description"].(string)
+			if value, ok := obj["default"].(string); ok {
+				param.Default = &value
+			}
+			macro.Params = append(macro.Params, param)
+		}
+	}
+
+	if err := h.macros.define(name, macro); err != nil {
+		var stepsErr *tmux.StepsError
+		if errors.As(err, &stepsErr) {
+			return invalidStepsError(err), nil
+		}
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	message := fmt.Sprintf("Macro %s defined", macroUsage(name, macro))
+	if h.macros.file == "" {
+		message += "; it lasts until the server stops, since no macros file is configured"
+	}
+	return mcp.NewToolResultText(message), nil
+}
+
+func (h *handler) runMacroHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	macro, ok := h.macros.get(name)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown macro %q; see list_macros", name)), nil
+	}
+
+	args := map[string]string{}
+	if raw, ok := request.GetArguments()["args"].(map[string]any); ok {
+		for key, value := range raw {
+			s, ok := value.(string)
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("argument %s must be a string", key)), nil
+			}
+			args[key] = s
+		}
+	}
+
+	steps, err := expandMacro(macro, args)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("macro %s: %v", name, err)), nil
+	}
+	if err := h.checkSteps(steps); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	opts := tmux.SendOptions{
+		DefaultDelay:  100 * time.Millisecond,
+		CaptureScreen: request.GetBool("capture_screen", true),
+		Progress:      h.progressReporter(ctx, request),
+	}
+
+	if request.GetBool("dry_run", false) {
+		return mcp.NewToolResultText(tmux.DescribePlan(sessionName, steps, opts)), nil
+	}
+
+	result, err := tmux.SendCommands(ctx, sessionName, steps, opts)
+	if err != nil {
+		return toolError(fmt.Sprintf("Failed to run macro %s", name), err), nil
+	}
+
+	return mcp.NewToolResultText(result), nil
+}
+
+func (h *handler) listMacrosHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var b strings.Builder
+
+	b.WriteString("Built-in macros:\n")
+	writeMacros(&b, builtinMacros)
+
+	user := h.macros.all()
+	if len(user) == 0 {
+		b.WriteString("\nNo user macros defined; add one with define_macro.\n")
+	} else {
+		b.WriteString("\nUser macros:\n")
+		writeMacros(&b, user)
+	}
+
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+// writeMacros lists macros by name with their description and steps
+func writeMacros(b *strings.Builder, macros map[string]config.Macro) {
+	for _, name := range slices.Sorted(maps.Keys(macros)) {
+		macro := macros[name]
+		b.WriteString("- " + macroUsage(name, macro))
+		if macro.Description != "" {
+			b.WriteString(": " + macro.Description)
+		}
+		b.WriteString("\n  steps: ")
+		encoder := json.NewEncoder(b)
+		encoder.SetEscapeHTML(false)
+		_ = encoder.Encode(macro.Steps)
+	}
+}
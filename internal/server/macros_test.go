@@ -0,0 +1,78 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lox/tmux-mcp-server/internal/config"
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinMacrosAreValid(t *testing.T) {
+	for name, macro := range builtinMacros {
+		assert.NoError(t, validateMacro(name, macro))
+	}
+}
+
+func TestMacroExpand(t *testing.T) {
+	branch := "main"
+	macro := config.Macro{
+		Params: []config.MacroParam{{Name: "message"}, {Name: "branch", Default: &branch}},
+		Steps:  []any{"git commit -m '{{message}}' && git push origin {{ branch }}", "<ENTER>"},
+	}
+	require.NoError(t, validateMacro("commit", macro))
+
+	steps, err := expandMacro(macro, map[string]string{"message": "<ENTER>"})
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.Equal(t, tmux.StepText, steps[0].Kind)
+	assert.Equal(t, "git commit -m '<ENTER>' && git push origin main", steps[0].Text, "arguments are typed literally")
+
+	_, err = expandMacro(macro, nil)
+	assert.EqualError(t, err, "missing argument message")
+	_, err = expandMacro(macro, map[string]string{"message": "x", "force": "yes"})
+	assert.EqualError(t, err, "unknown argument force")
+}
+
+func TestMacroValidation(t *testing.T) {
+	assert.ErrorContains(t, validateMacro("deploy", config.Macro{Steps: []any{"deploy {{env}}"}}), "{{env}}, which is not a parameter")
+	assert.ErrorContains(t, validateMacro("bad name", config.Macro{Steps: []any{"x"}}), "invalid macro name")
+	assert.ErrorContains(t, validateMacro("empty", config.Macro{}), "no steps")
+	assert.ErrorContains(t, validateMacro("keys", config.Macro{Steps: []any{"<NOPE>"}}), "step")
+
+	// Placeholders are only substituted into typed text, so elsewhere they
+	// would silently stay as written
+	branch := config.Macro{Params: []config.MacroParam{{Name: "prompt"}}, Steps: []any{"<IF /{{prompt}}/>", "y", "<ENDIF>"}}
+	assert.ErrorContains(t, validateMacro("branch", branch), "placeholders are only filled in text that is typed")
+	slow := config.Macro{Params: []config.MacroParam{{Name: "who"}}, Steps: []any{map[string]any{"type_slow": "hi {{who}}"}}}
+	assert.NoError(t, validateMacro("slow", slow))
+}
+
+func TestMacroStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macros.yaml")
+
+	store, err := loadMacros(path)
+	require.NoError(t, err)
+	require.NoError(t, store.define("hello", config.Macro{Params: []config.MacroParam{{Name: "who"}}, Steps: []any{"echo hello {{who}}", map[string]any{"key": "ENTER"}}}))
+	assert.ErrorContains(t, store.define("vim_save_quit", config.Macro{Steps: []any{"x"}}), "built-in")
+
+	reloaded, err := loadMacros(path)
+	require.NoError(t, err)
+	macro, ok := reloaded.get("hello")
+	require.True(t, ok)
+	steps, err := expandMacro(macro, map[string]string{"who": "world"})
+	require.NoError(t, err)
+	assert.Equal(t, "echo hello world", steps[0].Text)
+	assert.Equal(t, tmux.StepKey, steps[1].Kind)
+}
+
+func TestLoadMacrosRejectsBuiltinNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macros.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("macros:\n  vim_save_quit:\n    steps: [\":w\", \"<ENTER>\"]\n"), 0o600))
+
+	_, err := loadMacros(path)
+	assert.ErrorContains(t, err, "vim_save_quit is a built-in macro")
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// progressReporter returns a callback that forwards tmux.Progress updates to
+// the client as notifications/progress, or nil if the request carries no
+// progress token
+func (h *handler) progressReporter(ctx context.Context, request mcp.CallToolRequest) func(tmux.Progress) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+
+	token := request.Params.Meta.ProgressToken
+	s := server.ServerFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+
+	return func(p tmux.Progress) {
+		params := map[string]any{
+			"progressToken": token,
+			"progress":      p.Step,
+		}
+
+		// Once a loop has repeated steps the total is unknown, and left out
+		step := fmt.Sprintf("step %d", p.Step)
+		if p.Total > 0 {
+			step = fmt.Sprintf("step %d/%d", p.Step, p.Total)
+			params["total"] = p.Total
+		}
+
+		message := fmt.Sprintf("%s: %s (%s elapsed)", step, p.Text, p.Elapsed.Round(time.Millisecond))
+		if p.Screen != "" {
+			message += "\n\nScreen content:\n" + p.Screen
+		}
+		params["message"] = message
+
+		err := s.SendNotificationToClient(ctx, "notifications/progress", params)
+		if err != nil {
+			h.logger.Debug("failed to send progress notification", "error", err)
+		}
+	}
+}
@@ -3,57 +3,134 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/lox/tmux-mcp-server/internal/config"
 	"github.com/lox/tmux-mcp-server/internal/tmux"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-// Config holds server configuration
-type Config struct {
-	UseHTTP bool
-	Port    string
+// handler holds the state shared by the tool handlers
+type handler struct {
+	config config.Config
+	policy *config.Policy
+	logger *slog.Logger
+	// templates are the session templates, by name
+	templates map[string]config.Template
+	macros    *macroStore
 }
 
-// NewServer creates a new TTY MCP server
-func NewServer(config Config) (*server.MCPServer, error) {
+// NewServer creates a new TTY MCP server that logs to logger
+func NewServer(cfg config.Config, logger *slog.Logger) (*server.MCPServer, error) {
 	// Check if tmux is available
-	fmt.Fprintf(os.Stderr, "🔍 Checking tmux availability...\n")
+	logger.Debug("checking tmux availability")
 	if err := tmux.CheckTmuxAvailable(); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Tmux check failed: %v\n", err)
+		logger.Error("tmux check failed", "error", err)
 		return nil, fmt.Errorf("tmux check failed: %v\nPlease install tmux: brew install tmux (macOS) or apt-get install tmux (Ubuntu)", err)
 	}
-	fmt.Fprintf(os.Stderr, "✅ Tmux is available\n")
 
-	// Create a new MCP server (stdio only for now)
-	fmt.Fprintf(os.Stderr, "🖥️ Creating MCP server...\n")
+	caps, err := tmux.DetectCapabilities()
+	if err != nil {
+		logger.Error("unsupported tmux", "error", err)
+		return nil, err
+	}
+	logger.Debug("detected tmux", "version", caps.Version.String())
+
+	tmux.Configure(tmux.Config{
+		SocketName: cfg.Socket.Name,
+		SocketPath: cfg.Socket.Path,
+		Width:      cfg.Size.Width,
+		Height:     cfg.Size.Height,
+	})
+
+	policy, err := config.LoadPolicy(cfg.Policy.File)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := config.LoadTemplates(cfg.Templates.File)
+	if err != nil {
+		return nil, err
+	}
+
+	macros, err := loadMacros(cfg.Macros.File)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick up the sessions a previous run of the server left behind
+	reconcileCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	report, err := tmux.Reconcile(reconcileCtx)
+	cancel()
+	if err != nil {
+		logger.Warn("failed to reconcile sessions", "error", err)
+	} else {
+		logger.Info("reconciled sessions", "managed", report.Managed, "unmanaged", report.Unmanaged,
+			"pruned", report.Pruned, "resumed_recording", report.Repiped)
+	}
+
+	h := &handler{
+		config:    cfg,
+		policy:    policy,
+		logger:    logger,
+		templates: templates,
+		macros:    macros,
+	}
+
 	s := server.NewMCPServer(
 		"TTY MCP Server",
 		"1.0.0",
 		server.WithToolCapabilities(false),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(h.withTimeout),
 	)
-	fmt.Fprintf(os.Stderr, "✅ MCP server created\n")
 
 	// Register tools
-	fmt.Fprintf(os.Stderr, "🛠️ Registering tools...\n")
-	if err := registerTools(s); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Failed to register tools: %v\n", err)
+	if err := registerTools(s, h); err != nil {
+		logger.Error("failed to register tools", "error", err)
 		return nil, fmt.Errorf("failed to register tools: %v", err)
 	}
-	fmt.Fprintf(os.Stderr, "✅ Tools registered successfully\n")
+	logger.Info("server ready", "transport", cfg.Transport)
 
 	return s, nil
 }
 
-func registerTools(s *server.MCPServer) error {
+// NewLogger creates a logger writing at the configured level to stderr or a file
+func NewLogger(cfg config.LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %v", cfg.Level, err)
+	}
+
+	var out io.Writer = os.Stderr
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %v", err)
+		}
+		out = f
+	}
+
+	return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: level})), nil
+}
+
+func registerTools(s *server.MCPServer, h *handler) error {
 	// start_session tool
 	startSessionTool := mcp.NewTool("start_session",
 		mcp.WithDescription("Start a new terminal session using tmux"),
 		mcp.WithString("session_name",
-			mcp.Required(),
-			mcp.Description("Name of the session to create"),
+			mcp.Description("Name of the session to create; when omitted a unique name such as agent-calm-otter is generated and returned"),
+		),
+		mcp.WithString("if_exists",
+			mcp.Description("What to do when a session with this name already exists: error (the default), reuse it as it is, replace it (only sessions this server created), or suffix the name with -2, -3 and so on up to -100"),
+			mcp.Enum(ifExistsPolicies...),
 		),
 		mcp.WithString("command",
 			mcp.Description("Optional command to run (defaults to shell)"),
@@ -61,8 +138,31 @@ func registerTools(s *server.MCPServer) error {
 		mcp.WithString("working_directory",
 			mcp.Description("Working directory for the session"),
 		),
+		mcp.WithString("shell",
+			mcp.Description("Shell to run instead of the default, e.g. bash or /bin/zsh; it also runs command when both are given"),
+		),
+		mcp.WithObject("env",
+			mcp.Description("Environment variables to set in the session, instead of typing export commands. These are merged over the server's defaults such as PAGER=cat; an empty value unsets a default."),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("agent_profile",
+			mcp.Description("Start a clean shell without rc files, with a plain \"$ \" prompt, pagers such as less replaced by cat and history not saved"),
+		),
+		mcp.WithBoolean("colors",
+			mcp.Description("Keep colored output in the agent profile (default: false, which sets NO_COLOR=1)"),
+		),
+		mcp.WithBoolean("shell_integration",
+			mcp.Description("Start bash or zsh with prompt marks so command_history can report each command's output and exit code (cannot be combined with command)"),
+		),
+		mcp.WithString("description",
+			mcp.Description("What the session is for, shown by list_sessions"),
+		),
+		mcp.WithObject("labels",
+			mcp.Description("Free-form labels such as {\"project\": \"api\"}, shown by list_sessions and used to select sessions in list_sessions and close_sessions"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
 	)
-	s.AddTool(startSessionTool, startSessionHandler)
+	s.AddTool(startSessionTool, h.startSessionHandler)
 
 	// send_keys tool
 	sendKeysTool := mcp.NewTool("send_keys",
@@ -76,7 +176,61 @@ func registerTools(s *server.MCPServer) error {
 			mcp.Description("Keys to send to the session"),
 		),
 	)
-	s.AddTool(sendKeysTool, sendKeysHandler)
+	s.AddTool(sendKeysTool, h.sendKeysHandler)
+
+	// send_bytes tool
+	sendBytesTool := mcp.NewTool("send_bytes",
+		mcp.WithDescription("Send raw bytes to a terminal session, for escape sequences and control characters that have no key name"),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithString("hex",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Bytes to send as hex digits, e.g. \"1b5b41\" for ESC [ A; whitespace is ignored (at most %d bytes)", tmux.MaxSendBytes)),
+		),
+	)
+	s.AddTool(sendBytesTool, h.sendBytesHandler)
+
+	// mouse tool
+	mouseTool := mcp.NewTool("mouse",
+		mcp.WithDescription("Click, scroll or drag in a terminal session. Only works when the application in the pane has enabled mouse support. Coordinates are 0-based columns and rows from the top-left, as shown by view_session."),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Enum("click", "scroll", "drag"),
+			mcp.Description("Mouse action to perform"),
+		),
+		mcp.WithNumber("x",
+			mcp.Required(),
+			mcp.Description("Column of the event (or the start of a drag)"),
+		),
+		mcp.WithNumber("y",
+			mcp.Required(),
+			mcp.Description("Row of the event (or the start of a drag)"),
+		),
+		mcp.WithString("button",
+			mcp.Enum("left", "middle", "right"),
+			mcp.Description("Button for clicks and drags (default: left)"),
+		),
+		mcp.WithString("direction",
+			mcp.Enum("up", "down"),
+			mcp.Description("Direction for scrolls"),
+		),
+		mcp.WithNumber("count",
+			mcp.Description("Number of clicks or scroll steps (default: 1)"),
+		),
+		mcp.WithNumber("to_x",
+			mcp.Description("Column where a drag ends"),
+		),
+		mcp.WithNumber("to_y",
+			mcp.Description("Row where a drag ends"),
+		),
+	)
+	s.AddTool(mouseTool, h.mouseHandler)
 
 	// view_session tool
 	viewSessionTool := mcp.NewTool("view_session",
@@ -85,14 +239,53 @@ func registerTools(s *server.MCPServer) error {
 			mcp.Required(),
 			mcp.Description("Name of the session"),
 		),
+		mcp.WithBoolean("preserve_trailing_spaces",
+			mcp.Description("Keep trailing spaces at the end of each line (requires tmux 3.1+)"),
+		),
+	)
+	s.AddTool(viewSessionTool, h.viewSessionHandler)
+
+	// wait_for_idle tool
+	waitForIdleTool := mcp.NewTool("wait_for_idle",
+		mcp.WithDescription("Wait until a terminal session's screen has stopped changing, for commands with unpredictable output such as installs and test suites. Returns the final screen and how long it took."),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithNumber("quiet_ms",
+			mcp.Description("How long the screen must stay unchanged (default: 500)"),
+		),
+		mcp.WithNumber("timeout_ms",
+			mcp.Description("Give up if the screen is still changing after this long (default: 60000)"),
+		),
+	)
+	s.AddTool(waitForIdleTool, h.waitForIdleHandler)
+
+	// wait_for_prompt tool
+	waitForPromptTool := mcp.NewTool("wait_for_prompt",
+		mcp.WithDescription("Wait until the command running in a terminal session has finished and the shell is back in the foreground, so the next command can be sent. Returns the final screen."),
+		mcp.WithString("session_name",
+			mcp.Required(),
+			mcp.Description("Name of the session"),
+		),
+		mcp.WithString("prompt_pattern",
+			mcp.Description("Instead of watching the shell, wait until the last non-empty line of the screen, without trailing spaces, matches this regular expression, e.g. \"^>>>$\" for a Python REPL waiting for input"),
+		),
+		mcp.WithNumber("timeout_ms",
+			mcp.Description("Give up after this long (default: 300000)"),
+		),
 	)
-	s.AddTool(viewSessionTool, viewSessionHandler)
+	s.AddTool(waitForPromptTool, h.waitForPromptHandler)
 
 	// list_sessions tool
 	listSessionsTool := mcp.NewTool("list_sessions",
-		mcp.WithDescription("List all active terminal sessions"),
+		mcp.WithDescription("List all active terminal sessions, with how the server started the ones it created and their descriptions and labels"),
+		mcp.WithObject("labels",
+			mcp.Description("Only list sessions carrying all of these labels, e.g. {\"project\": \"api\"}"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
 	)
-	s.AddTool(listSessionsTool, listSessionsHandler)
+	s.AddTool(listSessionsTool, h.listSessionsHandler)
 
 	// send_commands tool (enhanced)
 	sendCommandsTool := mcp.NewTool("send_commands",
@@ -103,7 +296,7 @@ func registerTools(s *server.MCPServer) error {
 		),
 		mcp.WithArray("commands",
 			mcp.Required(),
-			mcp.Description("Array of commands to execute. Literals are typed as-is, <COMMAND> are special keys/actions"),
+			mcp.Description("Array of steps to execute. Strings are typed as-is unless written as <COMMAND>, a special key or action such as <ENTER>, <F5>, <CTRL+ALT+DELETE>, <DOWN*10>, <SLEEP 500ms>, <TYPE_SLOW text> to type one character at a time, <WAIT_IDLE 500ms max=60s> to wait until the screen stops changing or <HEX 1b5b41> for raw bytes, or a mouse event such as <CLICK 10,5>, <CLICK right 10,5>, <SCROLL up 3 at 10,5> or <DRAG 1,1 20,1>; wrap steps in <IF /regex/>...<ENDIF> or <UNTIL /regex/ max=N>...<END> to branch or loop on the screen content; add another < in front of a bracketed step, as in <<ENTER>, to type it literally. Steps may also be objects: {\"text\": \"...\"}, {\"type_slow\": \"...\"}, {\"key\": \"ENTER\"}, {\"sleep\": \"500ms\"} or {\"hex\": \"1b5b41\"}"),
 		),
 		mcp.WithNumber("default_delay_ms",
 			mcp.Description("Default delay between commands in milliseconds (default: 100)"),
@@ -111,8 +304,20 @@ func registerTools(s *server.MCPServer) error {
 		mcp.WithBoolean("capture_screen",
 			mcp.Description("Whether to capture and return the screen content after execution (default: true)"),
 		),
+		mcp.WithBoolean("validate_only",
+			mcp.Description("Only check that every step parses and is allowed; send nothing (default: false)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return the tmux invocations that would run instead of running them (default: false)"),
+		),
+		mcp.WithNumber("typing_delay_ms",
+			mcp.Description("Type text steps one character at a time with this delay between characters, for programs that misbehave when text arrives at once (default: 0, all at once)"),
+		),
+		mcp.WithNumber("progress_snapshot_ms",
+			mcp.Description("When the request has a progress token, include a screen capture in progress notifications at most this often (default: 0, never)"),
+		),
 	)
-	s.AddTool(sendCommandsTool, sendCommandsHandler)
+	s.AddTool(sendCommandsTool, h.sendCommandsHandler)
 
 	// join_session tool
 	joinSessionTool := mcp.NewTool("join_session",
@@ -125,7 +330,7 @@ func registerTools(s *server.MCPServer) error {
 			mcp.Description("Name for this client's view of the session (optional)"),
 		),
 	)
-	s.AddTool(joinSessionTool, joinSessionHandler)
+	s.AddTool(joinSessionTool, h.joinSessionHandler)
 
 	// close_session tool
 	closeSessionTool := mcp.NewTool("close_session",
@@ -135,29 +340,204 @@ func registerTools(s *server.MCPServer) error {
 			mcp.Description("Name of the session to close"),
 		),
 	)
-	s.AddTool(closeSessionTool, closeSessionHandler)
+	s.AddTool(closeSessionTool, h.closeSessionHandler)
+
+	// close_sessions tool
+	closeSessionsTool := mcp.NewTool("close_sessions",
+		mcp.WithDescription("Close every terminal session carrying all of the given labels"),
+		mcp.WithObject("labels",
+			mcp.Required(),
+			mcp.Description("Labels the sessions must carry, e.g. {\"project\": \"api\"}; at least one is required"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+	)
+	s.AddTool(closeSessionsTool, h.closeSessionsHandler)
+
+	registerBufferTools(s, h)
+	registerExpectTools(s, h)
+	registerHistoryTools(s, h)
+	registerTemplateTools(s, h)
+	registerMacroTools(s, h)
 
 	return nil
 }
 
-func startSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	sessionName, err := request.RequireString("session_name")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
+func (h *handler) startSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName := request.GetString("session_name", "")
+	ifExists := request.GetString("if_exists", "error")
+	if !slices.Contains(ifExistsPolicies, ifExists) {
+		return mcp.NewToolResultError(fmt.Sprintf("if_exists must be one of %s, got %q", strings.Join(ifExistsPolicies, ", "), ifExists)), nil
 	}
 
 	command := request.GetString("command", "")
 	workingDir := request.GetString("working_directory", "")
 
-	err = tmux.StartSession(sessionName, command, workingDir)
+	if workingDir == "" && len(h.config.Sandbox.AllowedDirs) > 0 {
+		workingDir = h.config.Sandbox.AllowedDirs[0]
+	}
+	if err := h.config.Sandbox.CheckDir(workingDir); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := h.policy.CheckCommand(command); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	shell := request.GetString("shell", h.config.Session.Shell)
+	if err := h.policy.CheckCommand(shell); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	env, err := h.sessionEnv(request.GetArguments()["env"])
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to start session: %v", err)), nil
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Session '%s' started successfully", sessionName)), nil
+	colors := request.GetBool("colors", false)
+	if colors {
+		delete(env, "NO_COLOR")
+	}
+
+	labels, err := labelsArg(request.GetArguments()["labels"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sessionName, reuse, err := h.resolveSessionName(ctx, sessionName, ifExists)
+	if err != nil {
+		return toolError("Failed to start session", err), nil
+	}
+	if reuse {
+		result := mcp.NewToolResultText(fmt.Sprintf("Session '%s' already exists and was reused as it is", sessionName))
+		result.Meta = map[string]any{"session_name": sessionName, "reused": true}
+		return result, nil
+	}
+
+	info, err := tmux.StartSessionWithOptions(ctx, sessionName, tmux.SessionOptions{
+		Command:          command,
+		WorkingDir:       workingDir,
+		Shell:            shell,
+		Env:              env,
+		ShellIntegration: request.GetBool("shell_integration", false),
+		AgentProfile:     request.GetBool("agent_profile", false),
+		Colors:           colors,
+		Description:      request.GetString("description", ""),
+		Labels:           labels,
+	})
+	if err != nil {
+		return toolError("Failed to start session", err), nil
+	}
+
+	message := fmt.Sprintf("Session '%s' started successfully", sessionName)
+	if len(info.Settings) > 0 {
+		message += "\n\nAgent profile:\n- " + strings.Join(info.Settings, "\n- ")
+	}
+	result := mcp.NewToolResultText(message)
+	result.Meta = map[string]any{"session_name": sessionName}
+	return result, nil
+}
+
+// ifExistsPolicies are the values of start_session's if_exists
+var ifExistsPolicies = []string{"error", "reuse", "replace", "suffix"}
+
+// resolveSessionName decides the name of a new session: a generated one when
+// none is given, otherwise the requested one with the if_exists policy
+// applied to a session already using it. It reports whether the existing
+// session should be reused instead.
+func (h *handler) resolveSessionName(ctx context.Context, name, ifExists string) (string, bool, error) {
+	if name == "" {
+		name, err := tmux.GenerateSessionName(ctx, h.config.Session.NamePrefix)
+		return name, false, err
+	}
+
+	state, exists, err := tmux.LookupSessionState(ctx, name)
+	if err != nil || !exists {
+		return name, false, err
+	}
+
+	switch ifExists {
+	case "reuse":
+		return name, true, nil
+	case "replace":
+		// Only sessions this server created are ours to kill
+		if !state.Meta.Managed {
+			return name, false, fmt.Errorf("session '%s' was not created by this server, so it can't be replaced; use reuse or suffix instead: %w", name, tmux.ErrDuplicateSession)
+		}
+		if err := tmux.KillSession(ctx, name); err != nil {
+			return name, false, fmt.Errorf("failed to replace session '%s': %w", name, err)
+		}
+		return name, false, nil
+	case "suffix":
+		name, err := tmux.UniqueSessionName(ctx, name)
+		return name, false, err
+	default:
+		return name, false, fmt.Errorf("session '%s' already exists: %w", name, tmux.ErrDuplicateSession)
+	}
 }
 
-func sendKeysHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// sessionEnv merges the env argument of start_session over the configured
+// defaults. The defaults are dropped when tmux can't set session variables,
+// so only an explicit env fails there.
+func (h *handler) sessionEnv(arg any) (map[string]string, error) {
+	env := map[string]string{}
+	if tmux.CurrentCapabilities().Supports(tmux.FeatureSessionEnvironment) {
+		maps.Copy(env, h.config.Session.Env)
+	}
+
+	if arg != nil {
+		vars, ok := arg.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("env must be an object of variable names to values")
+		}
+		for name, value := range vars {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("env value for %s must be a string", name)
+			}
+			if name == "" || strings.ContainsAny(name, "= ") {
+				return nil, fmt.Errorf("invalid env variable name %q", name)
+			}
+			env[name] = s
+		}
+	}
+
+	maps.DeleteFunc(env, func(_, value string) bool { return value == "" })
+	return env, nil
+}
+
+// labelsArg reads a labels argument, an object of label names to values
+func labelsArg(arg any) (map[string]string, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	values, ok := arg.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("labels must be an object of label names to values")
+	}
+
+	labels := make(map[string]string, len(values))
+	for name, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("label %s must be a string", name)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("label names must not be empty")
+		}
+		labels[name] = s
+	}
+	return labels, nil
+}
+
+// formatLabels renders labels as name=value pairs in name order
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, name+"="+labels[name])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (h *handler) sendKeysHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessionName, err := request.RequireString("session_name")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -168,60 +548,308 @@ func sendKeysHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.Cal
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	err = tmux.SendKeys(sessionName, keys)
+	if err := h.policy.CheckCommand(keys); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	err = tmux.SendKeys(ctx, sessionName, keys)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to send keys: %v", err)), nil
+		return toolError("Failed to send keys", err), nil
 	}
 
 	return mcp.NewToolResultText(fmt.Sprintf("Keys sent to session '%s'", sessionName)), nil
 }
 
-func viewSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (h *handler) sendBytesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessionName, err := request.RequireString("session_name")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	content, err := tmux.CapturePane(sessionName)
+	digits, err := request.RequireString("hex")
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to capture session: %v", err)), nil
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	data, err := tmux.ParseHex(digits)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := h.policy.CheckCommand(string(data)); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := tmux.SendBytes(ctx, sessionName, data); err != nil {
+		return toolError("Failed to send bytes", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Sent %d bytes to session '%s'", len(data), sessionName)), nil
+}
+
+func (h *handler) mouseHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	action, err := request.RequireString("action")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	x, err := request.RequireInt("x")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	y, err := request.RequireInt("y")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	event, err := tmux.NewMouseEvent(tmux.MouseEvent{
+		Action:    tmux.MouseAction(action),
+		Button:    request.GetString("button", ""),
+		Direction: request.GetString("direction", ""),
+		Count:     request.GetInt("count", 1),
+		X:         x,
+		Y:         y,
+		ToX:       request.GetInt("to_x", x),
+		ToY:       request.GetInt("to_y", y),
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := tmux.SendMouse(ctx, sessionName, event); err != nil {
+		return toolError("Failed to send mouse event", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Sent %s to session '%s'", event, sessionName)), nil
+}
+
+func (h *handler) viewSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	content, err := tmux.CapturePaneWithOptions(ctx, sessionName, tmux.CaptureOptions{
+		PreserveTrailingSpaces: request.GetBool("preserve_trailing_spaces", false),
+	})
+	if err != nil {
+		return toolError("Failed to capture session", err), nil
 	}
 
 	return mcp.NewToolResultText(content), nil
 }
 
-func listSessionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	sessions, err := tmux.ListSessions()
+func (h *handler) waitForIdleHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	quiet := time.Duration(request.GetFloat("quiet_ms", float64(tmux.DefaultIdleQuiet.Milliseconds()))) * time.Millisecond
+	timeout := time.Duration(request.GetFloat("timeout_ms", float64(tmux.DefaultIdleMax.Milliseconds()))) * time.Millisecond
+	if quiet <= 0 || timeout <= 0 {
+		return mcp.NewToolResultError("quiet_ms and timeout_ms must be positive"), nil
+	}
+
+	result, err := tmux.WaitForIdle(ctx, sessionName, quiet, timeout)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to list sessions: %v", err)), nil
+		return toolError("Failed to wait for idle", err), nil
 	}
 
-	return mcp.NewToolResultText(sessions), nil
+	return mcp.NewToolResultText(fmt.Sprintf("Idle after %s (unchanged for %s)\n\nScreen content:\n%s", result.Elapsed.Round(time.Millisecond), quiet, result.Screen)), nil
 }
 
-func sendCommandsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (h *handler) waitForPromptHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessionName, err := request.RequireString("session_name")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	commandsSlice, err := request.RequireStringSlice("commands")
+	var pattern *tmux.Condition
+	if source := request.GetString("prompt_pattern", ""); source != "" {
+		cond, err := tmux.NewCondition(source)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		pattern = &cond
+	}
+
+	timeout := time.Duration(request.GetFloat("timeout_ms", float64(tmux.DefaultPromptTimeout.Milliseconds()))) * time.Millisecond
+	if timeout <= 0 {
+		return mcp.NewToolResultError("timeout_ms must be positive"), nil
+	}
+
+	result, err := tmux.WaitForPrompt(ctx, sessionName, pattern, timeout)
 	if err != nil {
+		return toolError("Failed to wait for prompt", err), nil
+	}
+
+	message := fmt.Sprintf("Prompt is back after %s", result.Elapsed.Round(time.Millisecond))
+	if result.Command != "" {
+		message += fmt.Sprintf(" (foreground: %s)", result.Command)
+	}
+	return mcp.NewToolResultText(message + "\n\nScreen content:\n" + result.Screen), nil
+}
+
+func (h *handler) listSessionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	selector, err := labelsArg(request.GetArguments()["labels"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	states, err := tmux.ListSessionStates(ctx)
+	if err != nil {
+		return toolError("Failed to list sessions", err), nil
+	}
+
+	states = slices.DeleteFunc(states, func(state tmux.SessionState) bool {
+		return !state.Meta.HasLabels(selector)
+	})
+	if len(states) == 0 {
+		if len(selector) > 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("No sessions with labels %s", formatLabels(selector))), nil
+		}
+		return mcp.NewToolResultText("No active sessions"), nil
+	}
+
+	result := mcp.NewToolResultText(formatSessions(states))
+	result.Meta = map[string]any{"sessions": sessionMeta(states)}
+	return result, nil
+}
+
+// formatSessions describes each session on a line, followed by what the
+// server recorded about it when it created it
+func formatSessions(states []tmux.SessionState) string {
+	var b strings.Builder
+	for _, state := range states {
+		b.WriteString(fmt.Sprintf("%s: %d windows (created %s)", state.Name, state.Windows, state.Created.Format(time.DateTime)))
+		if state.Attached {
+			b.WriteString(" (attached)")
+		}
+		b.WriteString("\n")
+
+		meta := state.Meta
+		if !meta.Managed {
+			continue
+		}
+		details := []string{"started by this server"}
+		if meta.Template != "" {
+			details = append(details, "template "+meta.Template)
+		}
+		if meta.Command != "" {
+			details = append(details, "command "+meta.Command)
+		}
+		if meta.WorkingDir != "" {
+			details = append(details, "in "+meta.WorkingDir)
+		}
+		if meta.ShellIntegration {
+			details = append(details, "command history")
+		}
+		if meta.AgentProfile {
+			details = append(details, "agent profile")
+		}
+		b.WriteString("  " + strings.Join(details, ", ") + "\n")
+		if meta.Description != "" {
+			b.WriteString("  description: " + meta.Description + "\n")
+		}
+		if len(meta.Labels) > 0 {
+			b.WriteString("  labels: " + formatLabels(meta.Labels) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// sessionMeta describes the sessions for the result metadata
+func sessionMeta(states []tmux.SessionState) []map[string]any {
+	meta := make([]map[string]any, len(states))
+	for i, state := range states {
+		meta[i] = map[string]any{
+			"name":        state.Name,
+			"windows":     state.Windows,
+			"attached":    state.Attached,
+			"managed":     state.Meta.Managed,
+			"description": state.Meta.Description,
+			"labels":      state.Meta.Labels,
+		}
+	}
+	return meta
+}
+
+func (h *handler) sendCommandsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionName, err := request.RequireString("session_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	items, ok := request.GetArguments()["commands"].([]any)
+	if !ok {
+		return mcp.NewToolResultError("required argument \"commands\" must be an array"), nil
+	}
+
+	steps, err := tmux.ParseSteps(items)
+	if err != nil {
+		return invalidStepsError(err), nil
+	}
+
+	if err := h.checkSteps(steps); err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
 	defaultDelayMs := request.GetFloat("default_delay_ms", 100)
 	captureScreen := request.GetBool("capture_screen", true)
+	snapshotMs := request.GetFloat("progress_snapshot_ms", 0)
+	typingDelayMs := request.GetFloat("typing_delay_ms", 0)
+
+	opts := tmux.SendOptions{
+		DefaultDelay:     time.Duration(defaultDelayMs) * time.Millisecond,
+		CaptureScreen:    captureScreen,
+		Progress:         h.progressReporter(ctx, request),
+		SnapshotInterval: time.Duration(snapshotMs) * time.Millisecond,
+		TypingDelay:      time.Duration(typingDelayMs) * time.Millisecond,
+	}
 
-	result, err := tmux.SendCommands(sessionName, commandsSlice, int(defaultDelayMs), captureScreen)
+	if request.GetBool("validate_only", false) {
+		return mcp.NewToolResultText(fmt.Sprintf("All %d commands are valid; nothing was sent.", len(steps))), nil
+	}
+
+	if request.GetBool("dry_run", false) {
+		return mcp.NewToolResultText(tmux.DescribePlan(sessionName, steps, opts)), nil
+	}
+
+	result, err := tmux.SendCommands(ctx, sessionName, steps, opts)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to send commands: %v", err)), nil
+		return toolError("Failed to send commands", err), nil
 	}
 
 	return mcp.NewToolResultText(result), nil
 }
 
-func joinSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// checkSteps applies the command policy to every step that sends text
+func (h *handler) checkSteps(steps []tmux.Step) error {
+	for _, step := range steps {
+		var text string
+		switch step.Kind {
+		case tmux.StepText, tmux.StepTypeSlow:
+			text = step.Text
+		case tmux.StepBytes:
+			text = string(step.Bytes)
+		default:
+			continue
+		}
+		if err := h.policy.CheckCommand(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handler) joinSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessionName, err := request.RequireString("session_name")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -229,9 +857,9 @@ func joinSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 
 	newSessionName := request.GetString("new_session_name", "")
 
-	err = tmux.JoinSession(sessionName, newSessionName)
+	err = tmux.JoinSession(ctx, sessionName, newSessionName)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to join session: %v", err)), nil
+		return toolError("Failed to join session", err), nil
 	}
 
 	if newSessionName != "" {
@@ -241,42 +869,73 @@ func joinSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	}
 }
 
-func closeSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (h *handler) closeSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sessionName, err := request.RequireString("session_name")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	err = tmux.KillSession(sessionName)
+	err = tmux.KillSession(ctx, sessionName)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to close session: %v", err)), nil
+		return toolError("Failed to close session", err), nil
 	}
 
 	return mcp.NewToolResultText(fmt.Sprintf("Session '%s' closed successfully", sessionName)), nil
 }
 
-// Serve starts the server
-func Serve(s *server.MCPServer) error {
-	return server.ServeStdio(s)
-}
+func (h *handler) closeSessionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	selector, err := labelsArg(request.GetArguments()["labels"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(selector) == 0 {
+		return mcp.NewToolResultError("labels must select at least one label"), nil
+	}
 
-// ParseArgs parses command line arguments
-func ParseArgs(args []string) Config {
-	config := Config{
-		UseHTTP: false,
-		Port:    "8080",
+	states, err := tmux.ListSessionStates(ctx)
+	if err != nil {
+		return toolError("Failed to list sessions", err), nil
 	}
 
-	for i, arg := range args {
-		switch arg {
-		case "--http":
-			config.UseHTTP = true
-		case "--port":
-			if i+1 < len(args) {
-				config.Port = args[i+1]
+	var closed []string
+	for _, state := range states {
+		if !state.Meta.HasLabels(selector) {
+			continue
+		}
+		if err := tmux.KillSession(ctx, state.Name); err != nil {
+			res := toolError(fmt.Sprintf("Failed to close session '%s'", state.Name), err)
+			if len(closed) > 0 {
+				res.Content = append(res.Content, mcp.NewTextContent("Closed before the failure: "+strings.Join(closed, ", ")))
 			}
+			return res, nil
 		}
+		closed = append(closed, state.Name)
 	}
 
-	return config
+	if len(closed) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No sessions with labels %s", formatLabels(selector))), nil
+	}
+	return mcp.NewToolResultText("Closed sessions: " + strings.Join(closed, ", ")), nil
+}
+
+// withTimeout bounds each tool call by the configured per-tool timeout
+func (h *handler) withTimeout(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		timeout := h.config.Tools.TimeoutFor(request.Params.Name)
+		if timeout <= 0 {
+			return next(ctx, request)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return next(ctx, request)
+	}
+}
+
+// Serve starts the server on the configured transport
+func Serve(s *server.MCPServer, cfg config.Config, logger *slog.Logger) error {
+	if cfg.Transport == config.TransportHTTP {
+		return server.NewStreamableHTTPServer(s).Start(":" + cfg.HTTP.Port)
+	}
+	return serveStdio(s, logger)
 }
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stdioSession is the single client session of the stdio transport
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *stdioSession) SessionID() string { return "stdio" }
+
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *stdioSession) Initialize() { s.initialized.Store(true) }
+
+func (s *stdioSession) Initialized() bool { return s.initialized.Load() }
+
+// stdioTransport serves MCP over stdin/stdout. Unlike mcp-go's stdio server it
+// handles requests concurrently, so that notifications/cancelled can abort a
+// running tool call and closing stdin cancels everything in flight.
+type stdioTransport struct {
+	server *server.MCPServer
+	logger *slog.Logger
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	inflightMu sync.Mutex
+	inflight   map[string]context.CancelFunc
+}
+
+// methodNotificationCancelled is sent by clients to abandon a request
+const methodNotificationCancelled = "notifications/cancelled"
+
+// incomingMessage holds the fields needed to route a JSON-RPC message
+type incomingMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params struct {
+		RequestID json.RawMessage `json:"requestId,omitempty"`
+		Reason    string          `json:"reason,omitempty"`
+	} `json:"params"`
+}
+
+// serveStdio runs the stdio transport until stdin closes or a signal arrives
+func serveStdio(s *server.MCPServer, logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	t := &stdioTransport{
+		server:   s,
+		logger:   logger,
+		out:      os.Stdout,
+		inflight: map[string]context.CancelFunc{},
+	}
+	return t.listen(ctx, os.Stdin)
+}
+
+func (t *stdioTransport) listen(ctx context.Context, in io.Reader) error {
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := t.server.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("register session: %w", err)
+	}
+	defer t.server.UnregisterSession(ctx, session.SessionID())
+
+	ctx, cancel := context.WithCancel(t.server.WithContext(ctx, session))
+	defer cancel()
+
+	go t.forwardNotifications(ctx, session.notifications)
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			// The client went away; cancel whatever it was waiting for
+			cancel()
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read input: %w", err)
+		case line := <-lines:
+			t.dispatch(ctx, &wg, json.RawMessage(line))
+		}
+	}
+}
+
+// dispatch routes one message: cancellations are applied immediately, other
+// notifications are handled inline and requests run in their own goroutine
+func (t *stdioTransport) dispatch(ctx context.Context, wg *sync.WaitGroup, raw json.RawMessage) {
+	var msg incomingMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		response := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION}
+		response.Error.Code = mcp.PARSE_ERROR
+		response.Error.Message = "Parse error"
+		t.write(response)
+		return
+	}
+
+	if msg.Method == methodNotificationCancelled {
+		t.cancelRequest(requestKey(msg.Params.RequestID), msg.Params.Reason)
+		return
+	}
+
+	if len(msg.ID) == 0 {
+		t.server.HandleMessage(ctx, raw)
+		return
+	}
+
+	id := requestKey(msg.ID)
+	reqCtx, cancel := context.WithCancel(ctx)
+	t.inflightMu.Lock()
+	t.inflight[id] = cancel
+	t.inflightMu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			t.inflightMu.Lock()
+			delete(t.inflight, id)
+			t.inflightMu.Unlock()
+			cancel()
+		}()
+
+		if response := t.server.HandleMessage(reqCtx, raw); response != nil {
+			t.write(response)
+		}
+	}()
+}
+
+// requestKey normalises a raw JSON-RPC id so ids from requests and
+// cancellations compare equal
+func requestKey(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+// cancelRequest cancels the in-flight request with the given JSON-RPC id
+func (t *stdioTransport) cancelRequest(id, reason string) {
+	t.inflightMu.Lock()
+	cancel, ok := t.inflight[id]
+	t.inflightMu.Unlock()
+
+	if ok {
+		t.logger.Info("request cancelled by client", "id", id, "reason", reason)
+		cancel()
+	}
+}
+
+func (t *stdioTransport) forwardNotifications(ctx context.Context, notifications <-chan mcp.JSONRPCNotification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-notifications:
+			t.write(notification)
+		}
+	}
+}
+
+// write sends one JSON-RPC message per line
+func (t *stdioTransport) write(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.logger.Error("failed to marshal message", "error", err)
+		return
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	if _, err := fmt.Fprintf(t.out, "%s\n", data); err != nil {
+		t.logger.Error("failed to write message", "error", err)
+	}
+}
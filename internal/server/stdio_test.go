@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdioTransportCancelsInflightRequests(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("block"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		select {
+		case <-ctx.Done():
+			return mcp.NewToolResultError("cancelled: " + ctx.Err().Error()), nil
+		case <-time.After(10 * time.Second):
+			return mcp.NewToolResultText("finished"), nil
+		}
+	})
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	transport := &stdioTransport{
+		server:   s,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		out:      outWriter,
+		inflight: map[string]context.CancelFunc{},
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- transport.listen(context.Background(), inReader) }()
+
+	responses := bufio.NewScanner(outReader)
+	send := func(msg string) {
+		_, err := io.WriteString(inWriter, msg+"\n")
+		require.NoError(t, err)
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	require.True(t, responses.Scan())
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"block","arguments":{}}}`)
+	send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2,"reason":"test"}}`)
+
+	start := time.Now()
+	require.True(t, responses.Scan())
+	assert.Less(t, time.Since(start), 5*time.Second, "cancellation should be prompt")
+
+	var response struct {
+		ID     int `json:"id"`
+		Result struct {
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(responses.Bytes(), &response))
+	assert.Equal(t, 2, response.ID)
+	assert.True(t, response.Result.IsError)
+
+	// Closing stdin ends the transport
+	require.NoError(t, inWriter.Close())
+	go func() { _, _ = io.Copy(io.Discard, outReader) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("transport did not stop after stdin closed")
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/lox/tmux-mcp-server/internal/config"
+	"github.com/lox/tmux-mcp-server/internal/tmux"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func registerTemplateTools(s *server.MCPServer, h *handler) {
+	// list_templates tool
+	listTemplatesTool := mcp.NewTool("list_templates",
+		mcp.WithDescription("List the session templates configured on the server, with their windows and pane commands"),
+	)
+	s.AddTool(listTemplatesTool, h.listTemplatesHandler)
+
+	// start_from_template tool
+	startFromTemplateTool := mcp.NewTool("start_from_template",
+		mcp.WithDescription("Create a session from a template: its windows and panes are created, their commands started and their wait conditions awaited. Returns the pane map; pass a pane's target as session_name to other tools to use it."),
+		mcp.WithString("template",
+			mcp.Required(),
+			mcp.Description("Name of the template, as shown by list_templates"),
+		),
+		mcp.WithString("session_name",
+			mcp.Description("Name of the session to create; a unique name is generated when omitted"),
+		),
+		mcp.WithString("if_exists",
+			mcp.Description("What to do when a session with this name already exists: error (the default), reuse it as it is, replace it (only sessions this server created), or suffix the name with -2, -3 and so on up to -100"),
+			mcp.Enum(ifExistsPolicies...),
+		),
+	)
+	s.AddTool(startFromTemplateTool, h.startFromTemplateHandler)
+}
+
+func (h *handler) listTemplatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if len(h.templates) == 0 {
+		return mcp.NewToolResultText("No templates configured; set templates.file in the server configuration"), nil
+	}
+
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(h.templates)) {
+		tmpl := h.templates[name]
+		b.WriteString(name)
+		if tmpl.Description != "" {
+			b.WriteString(" - " + tmpl.Description)
+		}
+		b.WriteString("\n")
+		for i, w := range tmpl.Windows {
+			commands := make([]string, 0, len(w.PaneList()))
+			for _, p := range w.PaneList() {
+				command := p.Command
+				if command == "" {
+					command = "(shell)"
+				}
+				commands = append(commands, command)
+			}
+			b.WriteString(fmt.Sprintf("  window %s: %s\n", windowLabel(w, i), strings.Join(commands, " | ")))
+		}
+	}
+
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+// templatePane is a pane created from a template, for the pane map
+type templatePane struct {
+	pane    tmux.Pane
+	command string
+}
+
+func (h *handler) startFromTemplateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("template")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	tmpl, ok := h.templates[name]
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown template %q (available: %s)", name, strings.Join(slices.Sorted(maps.Keys(h.templates)), ", "))), nil
+	}
+	ifExists := request.GetString("if_exists", "error")
+	if !slices.Contains(ifExistsPolicies, ifExists) {
+		return mcp.NewToolResultError(fmt.Sprintf("if_exists must be one of %s, got %q", strings.Join(ifExistsPolicies, ", "), ifExists)), nil
+	}
+
+	if tmpl.WorkingDir == "" && len(h.config.Sandbox.AllowedDirs) > 0 {
+		tmpl.WorkingDir = h.config.Sandbox.AllowedDirs[0]
+	}
+	if err := h.checkTemplate(tmpl); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("template %s: %v", name, err)), nil
+	}
+
+	env, err := h.sessionEnv(nil)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// As with start_session's env, an empty value leaves a variable unset
+	maps.Copy(env, tmpl.Env)
+	maps.DeleteFunc(env, func(_, value string) bool { return value == "" })
+
+	sessionName, reuse, err := h.resolveSessionName(ctx, request.GetString("session_name", ""), ifExists)
+	if err != nil {
+		return toolError("Failed to start session", err), nil
+	}
+	if reuse {
+		result := mcp.NewToolResultText(fmt.Sprintf("Session '%s' already exists and was reused as it is", sessionName))
+		result.Meta = map[string]any{"session_name": sessionName, "reused": true}
+		return result, nil
+	}
+
+	info, err := tmux.StartSessionWithOptions(ctx, sessionName, tmux.SessionOptions{
+		WorkingDir: tmpl.PaneDir(0, 0),
+		Shell:      tmpl.Shell,
+		Env:        env,
+	})
+	if err != nil {
+		return toolError("Failed to start session", err), nil
+	}
+
+	// A half-built session is closed rather than left for the caller to find
+	abandon := func(action string, err error) *mcp.CallToolResult {
+		res := toolError(action, err)
+		if err := tmux.KillSession(context.WithoutCancel(ctx), sessionName); err != nil {
+			res.Content = append(res.Content, mcp.NewTextContent(fmt.Sprintf("Session '%s' could not be closed: %v", sessionName, err)))
+		} else {
+			res.Content = append(res.Content, mcp.NewTextContent(fmt.Sprintf("Session '%s' was closed", sessionName)))
+		}
+		return res
+	}
+
+	if err := tmux.SetSessionMeta(ctx, sessionName, tmux.SessionMeta{Template: name}); err != nil {
+		return abandon("Failed to start session", err), nil
+	}
+
+	panes, err := buildTemplate(ctx, sessionName, tmpl, info.Shell)
+	if err != nil {
+		return abandon(fmt.Sprintf("Failed to build template %s", name), err), nil
+	}
+
+	result := mcp.NewToolResultText(fmt.Sprintf("Session '%s' started from template %s\n\n%s", sessionName, name, formatPaneMap(panes)))
+	result.Meta = map[string]any{"session_name": sessionName, "panes": paneMeta(panes)}
+	return result, nil
+}
+
+// checkTemplate applies the sandbox and command policy to everything the
+// template would start, before any of it is created
+func (h *handler) checkTemplate(tmpl config.Template) error {
+	if err := h.policy.CheckCommand(tmpl.Shell); err != nil {
+		return err
+	}
+	for i, w := range tmpl.Windows {
+		for j, p := range w.PaneList() {
+			if err := h.config.Sandbox.CheckDir(tmpl.PaneDir(i, j)); err != nil {
+				return err
+			}
+			if err := h.policy.CheckCommand(p.Command); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildTemplate creates the template's windows and panes in a new session
+// and starts their commands. The panes created so far are returned even on
+// failure.
+func buildTemplate(ctx context.Context, sessionName string, tmpl config.Template, shell string) ([]templatePane, error) {
+	var panes []templatePane
+
+	for i, w := range tmpl.Windows {
+		var last tmux.Pane
+		for j, p := range w.PaneList() {
+			opts := tmux.WindowOptions{Name: w.Name, Command: shell, WorkingDir: tmpl.PaneDir(i, j), Env: p.Env}
+
+			var pane tmux.Pane
+			var err error
+			switch {
+			case i == 0 && j == 0:
+				// The session was created with this pane
+				if pane, err = tmux.DescribePane(ctx, sessionName); err != nil {
+					break
+				}
+				if len(p.Env) > 0 {
+					err = tmux.RespawnPane(ctx, pane.ID, opts)
+				}
+				if err == nil && w.Name != "" {
+					err = tmux.RenameWindow(ctx, pane.ID, w.Name)
+				}
+			case j == 0:
+				pane, err = tmux.NewWindow(ctx, sessionName, opts)
+			default:
+				pane, err = tmux.SplitWindow(ctx, last.ID, tmux.SplitOptions{
+					WindowOptions: opts,
+					Horizontal:    p.Split == "horizontal",
+					Percent:       p.Size,
+				})
+			}
+			if err != nil {
+				return panes, fmt.Errorf("window %s pane %d: %w", windowLabel(w, i), j, err)
+			}
+			panes = append(panes, templatePane{pane: pane, command: p.Command})
+			last = pane
+
+			if err := startTemplatePane(ctx, pane, p); err != nil {
+				return panes, fmt.Errorf("window %s pane %d: %w", windowLabel(w, i), j, err)
+			}
+		}
+
+		if w.Layout != "" {
+			if err := tmux.SelectLayout(ctx, last.ID, w.Layout); err != nil {
+				return panes, err
+			}
+		}
+	}
+
+	// Refresh the targets, which now reflect the final window names
+	for i, p := range panes {
+		pane, err := tmux.DescribePane(ctx, p.pane.ID)
+		if err != nil {
+			return panes, err
+		}
+		panes[i].pane = pane
+	}
+
+	return panes, nil
+}
+
+// startTemplatePane types a pane's command and waits for its wait_for
+// pattern, if any
+func startTemplatePane(ctx context.Context, pane tmux.Pane, p config.TemplatePane) error {
+	if p.WaitFor == "" {
+		if p.Command == "" {
+			return nil
+		}
+		_, err := tmux.SendCommands(ctx, pane.ID, lineSteps(p.Command), tmux.SendOptions{})
+		return err
+	}
+
+	cond, err := tmux.NewCondition(p.WaitFor)
+	if err != nil {
+		return err
+	}
+	timeout := p.WaitTimeout
+	if timeout == 0 {
+		timeout = config.DefaultTemplateWait
+	}
+
+	opts := tmux.ExpectOptions{End: cond, Timeout: timeout}
+	if p.Command != "" {
+		opts.Start = lineSteps(p.Command)
+	}
+	_, err = tmux.Expect(ctx, pane.ID, nil, opts)
+	return err
+}
+
+// windowLabel names a template window in messages
+func windowLabel(w config.TemplateWindow, index int) string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// formatPaneMap lists each pane's target, id and command
+func formatPaneMap(panes []templatePane) string {
+	var b strings.Builder
+	b.WriteString("Panes:\n")
+	for _, p := range panes {
+		command := p.command
+		if command == "" {
+			command = "(shell)"
+		}
+		b.WriteString(fmt.Sprintf("  %s (%s, window %s): %s\n", p.pane.Target, p.pane.ID, p.pane.Window, command))
+	}
+	return b.String()
+}
+
+// paneMeta describes the panes for the result metadata
+func paneMeta(panes []templatePane) []map[string]any {
+	meta := make([]map[string]any, len(panes))
+	for i, p := range panes {
+		meta[i] = map[string]any{
+			"target":  p.pane.Target,
+			"pane_id": p.pane.ID,
+			"window":  p.pane.Window,
+			"command": p.command,
+		}
+	}
+	return meta
+}
@@ -5,10 +5,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/lox/tmux-mcp-server/internal/client"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -60,11 +63,27 @@ func TestTTYServerIntegration(t *testing.T) {
 		expectedTools := []string{
 			"start_session",
 			"send_keys",
+			"send_bytes",
+			"mouse",
 			"send_commands",
 			"view_session",
+			"wait_for_idle",
+			"wait_for_prompt",
 			"list_sessions",
 			"join_session",
 			"close_session",
+			"close_sessions",
+			"set_buffer",
+			"paste_buffer",
+			"list_buffers",
+			"get_buffer",
+			"expect",
+			"command_history",
+			"list_templates",
+			"start_from_template",
+			"define_macro",
+			"run_macro",
+			"list_macros",
 		}
 
 		toolNames := make([]string, len(tools.Tools))
@@ -175,4 +194,1057 @@ func TestTTYServerIntegration(t *testing.T) {
 		closeText := client.GetToolResultText(closeResult)
 		assert.Contains(t, closeText, "closed successfully", "Expected session close confirmation")
 	})
+
+	t.Run("TestErrorCodes", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		// Closing a session that does not exist reports tmux's reason and a code
+		result, err := mcpClient.CloseSession(ctx, "test_no_such_session")
+		require.NoError(t, err, "Failed to call close_session")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "can't find session")
+		assert.Equal(t, "SESSION_NOT_FOUND", result.Meta["error_code"])
+
+		// Starting a duplicate session is reported as such
+		sessionName := "test_duplicate_session"
+		_, err = mcpClient.StartSession(ctx, sessionName, "", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		result, err = mcpClient.StartSession(ctx, sessionName, "", "")
+		require.NoError(t, err, "Failed to call start_session")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "DUPLICATE_SESSION", result.Meta["error_code"])
+	})
+
+	t.Run("TestToolTimeout", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary, "--tool-timeout", "1s")
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_tool_timeout"
+		_, err = mcpClient.StartSession(ctx, sessionName, "", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		// The sleep outlasts the timeout, so the run stops part way through
+		start := time.Now()
+		result, err := mcpClient.SendCommands(ctx, sessionName, []string{"echo one", "<SLEEP 5s>", "echo two"}, false)
+		require.NoError(t, err, "Failed to call send_commands")
+		assert.Less(t, time.Since(start), 4*time.Second, "Expected the timeout to abort the sleep")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "after 1 of 3 steps completed")
+		assert.Equal(t, "TIMEOUT", result.Meta["error_code"])
+	})
+
+	t.Run("TestSendCommandsProgress", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		var mu sync.Mutex
+		var messages []string
+		mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+			if notification.Method != "notifications/progress" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if msg, ok := notification.Params.AdditionalFields["message"].(string); ok {
+				messages = append(messages, msg)
+			}
+		})
+
+		sessionName := "test_send_commands_progress"
+		_, err = mcpClient.StartSession(ctx, sessionName, "", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		result, err := mcpClient.CallToolWithProgress(ctx, "send_commands", map[string]interface{}{
+			"session_name":         sessionName,
+			"commands":             []string{"echo progress", "<ENTER>", "<SLEEP 100ms>"},
+			"progress_snapshot_ms": 1,
+		}, "progress-test")
+		require.NoError(t, err, "Failed to call send_commands")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		// Notifications are delivered asynchronously
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(messages) == 3
+		}, 2*time.Second, 50*time.Millisecond, "Expected one progress notification per step")
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Contains(t, messages[0], "step 1/3: echo progress")
+		assert.Contains(t, messages[2], "Screen content:")
+	})
+
+	t.Run("TestSendCommandsValidation", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		// Every bad step is reported, without needing the session to exist
+		result, err := mcpClient.CallTool(ctx, "send_commands", map[string]interface{}{
+			"session_name":  "test_validation",
+			"commands":      []interface{}{"ls", "<ENTR>", "<SLEEP 2sec>"},
+			"validate_only": true,
+		})
+		require.NoError(t, err, "Failed to call send_commands")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "INVALID_STEPS", result.Meta["error_code"])
+		assert.Len(t, result.Meta["invalid_steps"], 2)
+		assert.Contains(t, client.GetToolResultText(result), "did you mean ENTER")
+
+		// A dry run shows the tmux invocations
+		result, err = mcpClient.CallTool(ctx, "send_commands", map[string]interface{}{
+			"session_name": "test_validation",
+			"commands":     []interface{}{map[string]interface{}{"text": "<b>"}, "<ENTER>"},
+			"dry_run":      true,
+		})
+		require.NoError(t, err, "Failed to call send_commands")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Contains(t, client.GetToolResultText(result), "send-keys -l -t test_validation '<b>'")
+	})
+
+	t.Run("TestBuffers", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_buffers"
+		_, err = mcpClient.StartSession(ctx, sessionName, "cat", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		content := "def f():\n    return 1\n"
+		result, err := mcpClient.CallTool(ctx, "set_buffer", map[string]interface{}{
+			"buffer_name": "test_code",
+			"content":     content,
+		})
+		require.NoError(t, err, "Failed to call set_buffer")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		result, err = mcpClient.CallTool(ctx, "get_buffer", map[string]interface{}{"buffer_name": "test_code"})
+		require.NoError(t, err, "Failed to call get_buffer")
+		assert.Equal(t, content, client.GetToolResultText(result))
+
+		result, err = mcpClient.CallTool(ctx, "list_buffers", nil)
+		require.NoError(t, err, "Failed to call list_buffers")
+		assert.Contains(t, client.GetToolResultText(result), "test_code: 22 bytes")
+
+		result, err = mcpClient.CallTool(ctx, "paste_buffer", map[string]interface{}{
+			"session_name": sessionName,
+			"buffer_name":  "test_code",
+			"delete_after": true,
+		})
+		require.NoError(t, err, "Failed to call paste_buffer")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		time.Sleep(200 * time.Millisecond)
+		result, err = mcpClient.ViewSession(ctx, sessionName)
+		require.NoError(t, err, "Failed to view session")
+		assert.Contains(t, client.GetToolResultText(result), "    return 1")
+
+		// The buffer was deleted by the paste
+		result, err = mcpClient.CallTool(ctx, "get_buffer", map[string]interface{}{"buffer_name": "test_code"})
+		require.NoError(t, err, "Failed to call get_buffer")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "BUFFER_NOT_FOUND", result.Meta["error_code"])
+	})
+
+	t.Run("TestSendBytes", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_send_bytes"
+		_, err = mcpClient.StartSession(ctx, sessionName, "cat -v", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		// cat -v shows the escape sequence it received
+		result, err := mcpClient.CallTool(ctx, "send_bytes", map[string]interface{}{
+			"session_name": sessionName,
+			"hex":          "1b 5b 41",
+		})
+		require.NoError(t, err, "Failed to call send_bytes")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		result, err = mcpClient.SendCommands(ctx, sessionName, []string{"<HEX 0d>"}, true)
+		require.NoError(t, err, "Failed to send commands")
+		assert.Contains(t, client.GetToolResultText(result), "^[[A")
+
+		result, err = mcpClient.CallTool(ctx, "send_bytes", map[string]interface{}{
+			"session_name": sessionName,
+			"hex":          "1b5",
+		})
+		require.NoError(t, err, "Failed to call send_bytes")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "odd number of digits")
+	})
+
+	t.Run("TestMouse", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		// Without mouse mode enabled the event is refused
+		plain := "test_mouse_plain"
+		_, err = mcpClient.StartSession(ctx, plain, "cat", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, plain) }()
+
+		result, err := mcpClient.CallTool(ctx, "mouse", map[string]interface{}{
+			"session_name": plain, "action": "click", "x": 2, "y": 1,
+		})
+		require.NoError(t, err, "Failed to call mouse")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "MOUSE_DISABLED", result.Meta["error_code"])
+
+		// With SGR mouse mode enabled, the terminal echoes the report it received
+		sessionName := "test_mouse"
+		_, err = mcpClient.StartSession(ctx, sessionName, `sh -c "printf '\\033[?1000h\\033[?1006h'; cat -v"`, "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		result, err = mcpClient.CallTool(ctx, "mouse", map[string]interface{}{
+			"session_name": sessionName, "action": "click", "x": 2, "y": 1,
+		})
+		require.NoError(t, err, "Failed to call mouse")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		result, err = mcpClient.SendCommands(ctx, sessionName, []string{"<SCROLL up 1 at 0,0>"}, true)
+		require.NoError(t, err, "Failed to send commands")
+		screen := client.GetToolResultText(result)
+		assert.Contains(t, screen, "[<0;3;2M")
+		assert.Contains(t, screen, "[<64;1;1M")
+
+		result, err = mcpClient.CallTool(ctx, "mouse", map[string]interface{}{
+			"session_name": sessionName, "action": "scroll", "direction": "up", "count": 0, "x": 0, "y": 0,
+		})
+		require.NoError(t, err, "Failed to call mouse")
+		assert.True(t, result.IsError, "a zero count is rejected rather than sent once")
+		assert.Contains(t, client.GetToolResultText(result), "mouse count must be between 1")
+	})
+
+	t.Run("TestTypingDelay", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_typing_delay"
+		_, err = mcpClient.StartSession(ctx, sessionName, "cat", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		start := time.Now()
+		result, err := mcpClient.CallTool(ctx, "send_commands", map[string]interface{}{
+			"session_name":    sessionName,
+			"commands":        []interface{}{"say \"$HOME\"", "<ENTER>", "<TYPE_SLOW ok;\\>", "<ENTER>"},
+			"typing_delay_ms": 30,
+		})
+		require.NoError(t, err, "Failed to call send_commands")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		// 14 characters with a 30ms gap between each, split over two steps
+		assert.GreaterOrEqual(t, time.Since(start), 12*30*time.Millisecond)
+		screen := client.GetToolResultText(result)
+		assert.Contains(t, screen, `say "$HOME"`)
+		assert.Contains(t, screen, `ok;\`)
+	})
+
+	t.Run("TestSendCommandsControlFlow", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_control_flow"
+		_, err = mcpClient.StartSession(ctx, sessionName, "sh", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		result, err := mcpClient.SendCommands(ctx, sessionName, []string{
+			"c=0", "<ENTER>",
+			"<UNTIL /count 3/ max=5>", "c=$((c+1)); echo count $c", "<ENTER>", "<END>",
+			"<IF /no such text/>", "echo skipped", "<ENTER>", "<ENDIF>",
+			"<IF /count 2/>", "echo took-branch", "<ENTER>", "<ENDIF>",
+		}, true)
+		require.NoError(t, err, "Failed to send commands")
+		text := client.GetToolResultText(result)
+		require.False(t, result.IsError, text)
+		assert.Contains(t, text, "3. <UNTIL /count 3/ max=5> matched after 3 iterations")
+		assert.Contains(t, text, "7. <IF /no such text/> did not match, skipped to step 11")
+		assert.Contains(t, text, "11. <IF /count 2/> matched")
+		assert.Contains(t, text, "\ntook-branch")
+		assert.NotContains(t, text, "echo skipped")
+
+		// A loop that never matches stops with a clear error
+		result, err = mcpClient.SendCommands(ctx, sessionName, []string{"<UNTIL /never/ max=2>", "<SLEEP 10ms>", "<END>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "CONDITION_NOT_MET", result.Meta["error_code"])
+		assert.Contains(t, client.GetToolResultText(result), "failed after 2 steps completed", "loop iterations are counted")
+	})
+
+	t.Run("TestExpect", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_expect"
+		_, err = mcpClient.StartSession(ctx, sessionName, "sh", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		// The prompts and the end pattern also appear in the typed command
+		// line, which must not match them: the dialogue would otherwise end
+		// during the sleep, before the real output
+		result, err := mcpClient.CallTool(ctx, "expect", map[string]interface{}{
+			"session_name": sessionName,
+			"command":      `sleep 1; printf 'Name: '; read n; printf 'Overwrite? [y/N] '; read a; echo "finished $n $a"`,
+			"rules": []interface{}{
+				map[string]interface{}{"pattern": `Overwrite\? \[y/N\]`, "send": "y"},
+				map[string]interface{}{"pattern": "Name:", "send": "bob"},
+			},
+			"end_pattern": "finished",
+			"timeout_ms":  5000,
+		})
+		require.NoError(t, err, "Failed to call expect")
+		text := client.GetToolResultText(result)
+		require.False(t, result.IsError, text)
+		assert.Contains(t, text, `rule 2 matched "Name:", sent bob <ENTER>`)
+		assert.Contains(t, text, `rule 1 matched "Overwrite? [y/N]", sent y <ENTER>`)
+		assert.Contains(t, text, "end pattern matched")
+		assert.Contains(t, text, "finished bob y")
+
+		// Prompts from before the call are not answered again
+		result, err = mcpClient.CallTool(ctx, "expect", map[string]interface{}{
+			"session_name": sessionName,
+			"rules":        []interface{}{map[string]interface{}{"pattern": "Name:", "send": "again"}},
+			"end_pattern":  "never",
+			"timeout_ms":   300,
+		})
+		require.NoError(t, err, "Failed to call expect")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "CONDITION_NOT_MET", result.Meta["error_code"])
+		require.Len(t, result.Content, 2, "the transcript follows the error")
+		transcript, ok := mcp.AsTextContent(result.Content[1])
+		require.True(t, ok)
+		assert.Contains(t, transcript.Text, "Dialogue stopped after 0 responses", "the prompt still on screen was answered again")
+
+		result, err = mcpClient.CallTool(ctx, "expect", map[string]interface{}{
+			"session_name": sessionName,
+			"rules":        []interface{}{map[string]interface{}{"pattern": "Name:", "send": "again", "timeout_ms": 0}},
+			"end_pattern":  "never",
+		})
+		require.NoError(t, err, "Failed to call expect")
+		assert.True(t, result.IsError, "a zero rule timeout is rejected")
+		assert.Contains(t, client.GetToolResultText(result), "timeout_ms must be positive")
+
+		result, err = mcpClient.CallTool(ctx, "expect", map[string]interface{}{
+			"session_name":  sessionName,
+			"rules":         []interface{}{map[string]interface{}{"pattern": "Name:", "send": "again"}},
+			"end_pattern":   "never",
+			"max_responses": 0,
+		})
+		require.NoError(t, err, "Failed to call expect")
+		assert.True(t, result.IsError, "a zero max_responses is rejected")
+		assert.Contains(t, client.GetToolResultText(result), "max_responses must be at least 1")
+	})
+
+	t.Run("TestWaitForIdle", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_wait_for_idle"
+		_, err = mcpClient.StartSession(ctx, sessionName, "sh", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		// Output keeps changing for about a second, then stops
+		result, err := mcpClient.SendCommands(ctx, sessionName, []string{
+			"for i in 1 2 3 4 5; do echo tick $i; sleep 0.2; done", "<ENTER>",
+			"<WAIT_IDLE 500ms max=10s>",
+		}, true)
+		require.NoError(t, err, "Failed to send commands")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Contains(t, client.GetToolResultText(result), "tick 5")
+
+		result, err = mcpClient.CallTool(ctx, "wait_for_idle", map[string]interface{}{
+			"session_name": sessionName,
+			"quiet_ms":     200,
+		})
+		require.NoError(t, err, "Failed to call wait_for_idle")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Contains(t, client.GetToolResultText(result), "Idle after")
+
+		// A pane that never settles times out
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{"i=0; while true; do i=$((i+1)); echo $i; sleep 0.05; done", "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+		result, err = mcpClient.CallTool(ctx, "wait_for_idle", map[string]interface{}{
+			"session_name": sessionName,
+			"timeout_ms":   1000,
+		})
+		require.NoError(t, err, "Failed to call wait_for_idle")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "CONDITION_NOT_MET", result.Meta["error_code"])
+	})
+
+	t.Run("TestWaitForPrompt", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_wait_for_prompt"
+		_, err = mcpClient.StartSession(ctx, sessionName, "sh", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{"sleep 1; echo slept", "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+
+		start := time.Now()
+		result, err := mcpClient.CallTool(ctx, "wait_for_prompt", map[string]interface{}{"session_name": sessionName})
+		require.NoError(t, err, "Failed to call wait_for_prompt")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+		assert.Contains(t, client.GetToolResultText(result), "\nslept")
+
+		// A command that outlives the timeout is reported by name
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{"sleep 5", "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+		result, err = mcpClient.CallTool(ctx, "wait_for_prompt", map[string]interface{}{
+			"session_name": sessionName,
+			"timeout_ms":   500,
+		})
+		require.NoError(t, err, "Failed to call wait_for_prompt")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "'sleep' was still running")
+		assert.Equal(t, "CONDITION_NOT_MET", result.Meta["error_code"])
+
+		result, err = mcpClient.CallTool(ctx, "wait_for_prompt", map[string]interface{}{
+			"session_name": sessionName,
+			"timeout_ms":   0,
+		})
+		require.NoError(t, err, "Failed to call wait_for_prompt")
+		assert.True(t, result.IsError, "a zero timeout is rejected")
+		assert.Contains(t, client.GetToolResultText(result), "timeout_ms must be positive")
+	})
+
+	t.Run("TestCommandHistory", func(t *testing.T) {
+		bash, err := exec.LookPath("bash")
+		if err != nil {
+			t.Skip("bash is not installed")
+		}
+		t.Setenv("SHELL", bash)
+
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_command_history"
+		result, err := mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name":      sessionName,
+			"working_directory": "/tmp",
+			"shell_integration": true,
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{"echo one; false", "<ENTER>", "cd / && echo two", "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+
+		// The shell may still be reading its rc files, so poll until both
+		// commands have finished
+		var text string
+		require.Eventually(t, func() bool {
+			result, err := mcpClient.CallTool(ctx, "command_history", map[string]interface{}{"session_name": sessionName})
+			if err != nil || result.IsError {
+				return false
+			}
+			text = client.GetToolResultText(result)
+			return strings.Contains(text, "2. [exit")
+		}, 10*time.Second, 200*time.Millisecond, "commands never finished")
+		assert.Contains(t, text, "1. [exit 1] /tmp$ echo one; false\n   one\n")
+		assert.Contains(t, text, "2. [exit 0] /tmp$ cd / && echo two\n   two\n")
+
+		// Sessions started without it have no history
+		plainSession := "test_command_history_plain"
+		_, err = mcpClient.StartSession(ctx, plainSession, "", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, plainSession) }()
+
+		result, err = mcpClient.CallTool(ctx, "command_history", map[string]interface{}{"session_name": plainSession})
+		require.NoError(t, err, "Failed to call command_history")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "NO_SHELL_INTEGRATION", result.Meta["error_code"])
+	})
+
+	t.Run("TestSessionEnv", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_session_env"
+		result, err := mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name": sessionName,
+			"shell":        "sh",
+			"command":      `echo "token=$API_TOKEN pager=$PAGER color=${NO_COLOR-unset}"; sleep 30`,
+			"env":          map[string]interface{}{"API_TOKEN": "s3cret", "NO_COLOR": ""},
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		view, err := mcpClient.ViewSession(ctx, sessionName)
+		require.NoError(t, err, "Failed to view session")
+		assert.Contains(t, client.GetToolResultText(view), "token=s3cret pager=cat color=unset")
+
+		// An unknown shell is reported before the session is created
+		result, err = mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name": "test_session_env_bad_shell",
+			"shell":        "no-such-shell",
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), `shell "no-such-shell" not found`)
+	})
+
+	t.Run("TestAgentProfile", func(t *testing.T) {
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("bash is not installed")
+		}
+
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_agent_profile"
+		result, err := mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name":      sessionName,
+			"shell":             "bash",
+			"agent_profile":     true,
+			"shell_integration": true,
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		text := client.GetToolResultText(result)
+		assert.Contains(t, text, "Agent profile:")
+		assert.Contains(t, text, "without rc files")
+		assert.Contains(t, text, "NO_COLOR=1")
+
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{`echo "pager=$PAGER history=$HISTFILE"`, "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+
+		var history string
+		require.Eventually(t, func() bool {
+			result, err := mcpClient.CallTool(ctx, "command_history", map[string]interface{}{"session_name": sessionName})
+			if err != nil || result.IsError {
+				return false
+			}
+			history = client.GetToolResultText(result)
+			return strings.Contains(history, "1. [exit")
+		}, 10*time.Second, 200*time.Millisecond, "command never finished")
+		assert.Contains(t, history, "pager=cat history=/dev/null")
+
+		view, err := mcpClient.ViewSession(ctx, sessionName)
+		require.NoError(t, err, "Failed to view session")
+		assert.Contains(t, client.GetToolResultText(view), "\n$\n", "plain prompt")
+
+		// Variables set explicitly win over the profile's
+		envSession := "test_agent_profile_env"
+		result, err = mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name":  envSession,
+			"shell":         "bash",
+			"agent_profile": true,
+			"env":           map[string]interface{}{"PAGER": "less"},
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, envSession) }()
+		assert.Contains(t, client.GetToolResultText(result), "kept from env: PAGER=less")
+
+		result, err = mcpClient.SendCommands(ctx, envSession, []string{`echo "pager=[$PAGER] git=[$GIT_PAGER]"`, "<ENTER>", "<SLEEP 300ms>"}, true)
+		require.NoError(t, err, "Failed to send commands")
+		assert.Contains(t, client.GetToolResultText(result), "\npager=[less] git=[cat]")
+	})
+
+	t.Run("TestTemplates", func(t *testing.T) {
+		dir := t.TempDir()
+		templates := filepath.Join(dir, "templates.yaml")
+		require.NoError(t, os.WriteFile(templates, []byte(`
+templates:
+  stack:
+    description: Server and logs
+    working_directory: `+dir+`
+    env:
+      APP_PORT: "4242"
+    windows:
+      - name: server
+        layout: even-horizontal
+        panes:
+          - command: echo "serving on $APP_PORT"
+            wait_for: serving on 4242
+            wait_timeout: 5s
+          - command: echo "role=$ROLE in ${PWD##*/}"
+            split: horizontal
+            env:
+              ROLE: logs
+      - name: scratch
+  echoed:
+    windows:
+      - panes:
+          - command: sleep 1; echo "ready and listening"
+            wait_for: listening
+  unset_env:
+    env:
+      PAGER: ""
+    windows:
+      - panes:
+          - command: echo "pager=${PAGER-unset}"
+            wait_for: pager=unset
+            wait_timeout: 5s
+  broken:
+    windows:
+      - panes:
+          - command: echo started
+            wait_for: never printed
+            wait_timeout: 500ms
+`), 0o600))
+
+		mcpClient, err := client.NewStdioClient(serverBinary, "--templates", templates)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		result, err := mcpClient.CallTool(ctx, "list_templates", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_templates")
+		assert.Contains(t, client.GetToolResultText(result), "stack - Server and logs\n  window server: echo")
+
+		sessionName := "test_template"
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{
+			"template":     "stack",
+			"session_name": sessionName,
+		})
+		require.NoError(t, err, "Failed to call start_from_template")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		text := client.GetToolResultText(result)
+		assert.Contains(t, text, sessionName+":0.0")
+		assert.Contains(t, text, sessionName+":0.1")
+		assert.Contains(t, text, "window scratch): (shell)")
+		panes, ok := result.Meta["panes"].([]interface{})
+		require.True(t, ok, "Expected a pane map in the metadata")
+		assert.Len(t, panes, 3)
+
+		// The second pane got its own environment and the template's directory
+		require.Eventually(t, func() bool {
+			view, err := mcpClient.ViewSession(ctx, sessionName+":0.1")
+			return err == nil && strings.Contains(client.GetToolResultText(view), "role=logs in "+filepath.Base(dir))
+		}, 15*time.Second, 200*time.Millisecond, "second pane never ran its command")
+
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "missing"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "available: broken, echoed, stack, unset_env")
+
+		// Names are resolved as they are for start_session
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "stack", "session_name": sessionName})
+		require.NoError(t, err, "Failed to call start_from_template")
+		assert.Equal(t, "DUPLICATE_SESSION", result.Meta["error_code"])
+
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "stack", "session_name": sessionName, "if_exists": "reuse"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Equal(t, true, result.Meta["reused"])
+
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "stack"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		generated, ok := result.Meta["session_name"].(string)
+		require.True(t, ok, "Expected the generated name in the metadata")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, generated) }()
+		assert.Regexp(t, `^agent-[a-z]+-[a-z]+$`, generated)
+
+		// wait_for is only satisfied by output, not by the typed command
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "echoed", "session_name": "test_template_echoed"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		defer func() { _, _ = mcpClient.CloseSession(ctx, "test_template_echoed") }()
+		view, err := mcpClient.ViewSession(ctx, "test_template_echoed")
+		require.NoError(t, err, "Failed to view session")
+		assert.Contains(t, client.GetToolResultText(view), "\nready and listening")
+
+		// An empty template env value unsets the server's default PAGER
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "unset_env", "session_name": "test_template_unset_env"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, "test_template_unset_env") }()
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		// A template that fails part way leaves no session behind
+		result, err = mcpClient.CallTool(ctx, "start_from_template", map[string]interface{}{"template": "broken", "session_name": "test_template_broken"})
+		require.NoError(t, err, "Failed to call start_from_template")
+		assert.True(t, result.IsError, "Expected an error result")
+		list, err := mcpClient.CallTool(ctx, "list_sessions", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_sessions")
+		assert.NotContains(t, client.GetToolResultText(list), "test_template_broken")
+	})
+
+	t.Run("TestMacros", func(t *testing.T) {
+		macrosFile := filepath.Join(t.TempDir(), "macros.yaml")
+
+		mcpClient, err := client.NewStdioClient(serverBinary, "--macros", macrosFile)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_macros"
+		_, err = mcpClient.StartSession(ctx, sessionName, "sh", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		result, err := mcpClient.CallTool(ctx, "define_macro", map[string]interface{}{
+			"name":   "greet",
+			"steps":  []interface{}{"echo greeting-{{who}}-{{punct}}", "<ENTER>"},
+			"params": []interface{}{map[string]interface{}{"name": "who"}, map[string]interface{}{"name": "punct", "default": "done"}},
+		})
+		require.NoError(t, err, "Failed to call define_macro")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.FileExists(t, macrosFile)
+
+		result, err = mcpClient.CallTool(ctx, "run_macro", map[string]interface{}{
+			"session_name": sessionName,
+			"name":         "greet",
+			"args":         map[string]interface{}{"who": "world"},
+		})
+		require.NoError(t, err, "Failed to call run_macro")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Contains(t, client.GetToolResultText(result), "\ngreeting-world-done")
+
+		result, err = mcpClient.CallTool(ctx, "run_macro", map[string]interface{}{
+			"session_name": sessionName,
+			"name":         "greet",
+		})
+		require.NoError(t, err, "Failed to call run_macro")
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Contains(t, client.GetToolResultText(result), "missing argument who")
+
+		result, err = mcpClient.CallTool(ctx, "list_macros", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_macros")
+		text := client.GetToolResultText(result)
+		assert.Contains(t, text, "- vim_save_quit(): Save the file and quit vim\n  steps: [\"<ESCAPE>\",\":wq\",\"<ENTER>\"]")
+		assert.Contains(t, text, "- greet(who, punct=done)")
+	})
+
+	t.Run("TestSessionRehydration", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		first, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		require.NoError(t, first.Initialize(ctx), "Failed to initialize client")
+
+		sessionName := "test_rehydration"
+		result, err := first.CallTool(ctx, "start_session", map[string]interface{}{
+			"session_name":      sessionName,
+			"command":           "sleep 30",
+			"working_directory": os.TempDir(),
+		})
+		require.NoError(t, err, "Failed to call start_session")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		require.NoError(t, first.Close())
+
+		// A new server process finds the session and what it was started with
+		second, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = second.Close() }()
+		require.NoError(t, second.Initialize(ctx), "Failed to initialize client")
+		defer func() { _, _ = second.CloseSession(ctx, sessionName) }()
+
+		result, err = second.CallTool(ctx, "list_sessions", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_sessions")
+		text := client.GetToolResultText(result)
+		assert.Contains(t, text, sessionName+": 1 windows")
+		assert.Contains(t, text, "started by this server, command sleep 30, in "+os.TempDir())
+	})
+
+	t.Run("TestSessionLabels", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessions := map[string]map[string]interface{}{
+			"test_labels_api":  {"project": "api", "role": "server"},
+			"test_labels_web":  {"project": "web", "role": "server"},
+			"test_labels_misc": {"project": "api", "role": "scratch"},
+		}
+		for name, labels := range sessions {
+			result, err := mcpClient.CallTool(ctx, "start_session", map[string]interface{}{
+				"session_name": name,
+				"command":      "sleep 30",
+				"description":  "labelled " + name,
+				"labels":       labels,
+			})
+			require.NoError(t, err, "Failed to call start_session")
+			require.False(t, result.IsError, client.GetToolResultText(result))
+			defer func() { _, _ = mcpClient.CloseSession(ctx, name) }()
+		}
+
+		result, err := mcpClient.CallTool(ctx, "list_sessions", map[string]interface{}{
+			"labels": map[string]interface{}{"project": "api"},
+		})
+		require.NoError(t, err, "Failed to call list_sessions")
+		text := client.GetToolResultText(result)
+		assert.Contains(t, text, "description: labelled test_labels_api")
+		assert.Contains(t, text, "labels: project=api, role=server")
+		assert.Contains(t, text, "test_labels_misc")
+		assert.NotContains(t, text, "test_labels_web")
+
+		result, err = mcpClient.CallTool(ctx, "close_sessions", map[string]interface{}{
+			"labels": map[string]interface{}{"role": "server"},
+		})
+		require.NoError(t, err, "Failed to call close_sessions")
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		result, err = mcpClient.CallTool(ctx, "list_sessions", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_sessions")
+		text = client.GetToolResultText(result)
+		assert.NotContains(t, text, "test_labels_api")
+		assert.NotContains(t, text, "test_labels_web")
+		assert.Contains(t, text, "test_labels_misc")
+
+		// Closing everything needs an explicit selector
+		result, err = mcpClient.CallTool(ctx, "close_sessions", map[string]interface{}{
+			"labels": map[string]interface{}{},
+		})
+		require.NoError(t, err, "Failed to call close_sessions")
+		assert.True(t, result.IsError, "Expected an error result")
+	})
+
+	t.Run("TestSessionNames", func(t *testing.T) {
+		mcpClient, err := client.NewStdioClient(serverBinary, "--session-prefix", "itest")
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		started := map[string]bool{}
+		defer func() {
+			for name := range started {
+				_, _ = mcpClient.CloseSession(ctx, name)
+			}
+		}()
+		start := func(args map[string]interface{}) *mcp.CallToolResult {
+			args["command"] = "sleep 30"
+			result, err := mcpClient.CallTool(ctx, "start_session", args)
+			require.NoError(t, err, "Failed to call start_session")
+			if name, ok := result.Meta["session_name"].(string); ok {
+				started[name] = true
+			}
+			return result
+		}
+
+		// Without a name one is generated from the prefix
+		result := start(map[string]interface{}{})
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Regexp(t, `^itest-[a-z]+-[a-z]+$`, result.Meta["session_name"])
+
+		sessionName := "test_if_exists"
+		result = start(map[string]interface{}{"session_name": sessionName})
+		require.False(t, result.IsError, client.GetToolResultText(result))
+
+		result = start(map[string]interface{}{"session_name": sessionName})
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "DUPLICATE_SESSION", result.Meta["error_code"])
+
+		result = start(map[string]interface{}{"session_name": sessionName, "if_exists": "reuse"})
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Equal(t, true, result.Meta["reused"])
+
+		result = start(map[string]interface{}{"session_name": sessionName, "if_exists": "suffix"})
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Equal(t, sessionName+"-2", result.Meta["session_name"])
+
+		result = start(map[string]interface{}{"session_name": sessionName, "if_exists": "replace", "description": "replacement"})
+		require.False(t, result.IsError, client.GetToolResultText(result))
+		assert.Equal(t, sessionName, result.Meta["session_name"])
+
+		list, err := mcpClient.CallTool(ctx, "list_sessions", map[string]interface{}{})
+		require.NoError(t, err, "Failed to call list_sessions")
+		assert.Contains(t, client.GetToolResultText(list), "description: replacement")
+
+		result = start(map[string]interface{}{"session_name": sessionName, "if_exists": "overwrite"})
+		assert.True(t, result.IsError, "Expected an error result")
+
+		// Sessions created outside the server are never replaced
+		unmanaged := "test_if_exists_unmanaged"
+		require.NoError(t, exec.Command("tmux", "new-session", "-d", "-s", unmanaged, "sleep 30").Run())
+		defer func() { _ = exec.Command("tmux", "kill-session", "-t", "="+unmanaged).Run() }()
+
+		result = start(map[string]interface{}{"session_name": unmanaged, "if_exists": "replace"})
+		assert.True(t, result.IsError, "Expected an error result")
+		assert.Equal(t, "DUPLICATE_SESSION", result.Meta["error_code"])
+		assert.Contains(t, client.GetToolResultText(result), "not created by this server")
+	})
+
+	t.Run("TestWaitForPromptREPL", func(t *testing.T) {
+		if _, err := exec.LookPath("python3"); err != nil {
+			t.Skip("python3 is not installed")
+		}
+
+		mcpClient, err := client.NewStdioClient(serverBinary)
+		require.NoError(t, err, "Failed to create client")
+		defer func() { _ = mcpClient.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err = mcpClient.Initialize(ctx)
+		require.NoError(t, err, "Failed to initialize client")
+
+		sessionName := "test_wait_for_repl"
+		_, err = mcpClient.StartSession(ctx, sessionName, "python3 -q", "")
+		require.NoError(t, err, "Failed to start session")
+		defer func() { _, _ = mcpClient.CloseSession(ctx, sessionName) }()
+
+		waitForREPL := func() *mcp.CallToolResult {
+			result, err := mcpClient.CallTool(ctx, "wait_for_prompt", map[string]interface{}{
+				"session_name":   sessionName,
+				"prompt_pattern": "^>>>$",
+				"timeout_ms":     10000,
+			})
+			require.NoError(t, err, "Failed to call wait_for_prompt")
+			require.False(t, result.IsError, client.GetToolResultText(result))
+			return result
+		}
+		waitForREPL()
+
+		_, err = mcpClient.SendCommands(ctx, sessionName, []string{"import time; time.sleep(1); print('slept')", "<ENTER>"}, false)
+		require.NoError(t, err, "Failed to send commands")
+
+		start := time.Now()
+		result := waitForREPL()
+		assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond, "the prompt counts only once it is back")
+		assert.Contains(t, client.GetToolResultText(result), "\nslept")
+	})
 }
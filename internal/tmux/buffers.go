@@ -0,0 +1,97 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Buffer describes a tmux paste buffer
+type Buffer struct {
+	Name string
+	// Size is the buffer length in bytes
+	Size int
+	// Sample is tmux's escaped preview of the start of the buffer
+	Sample string
+}
+
+// PasteOptions controls how a buffer is pasted into a pane
+type PasteOptions struct {
+	// Bracketed wraps the paste in bracketed paste sequences when the
+	// application has requested them, so editors and REPLs don't auto-indent
+	Bracketed bool
+	// Delete removes the buffer once it has been pasted
+	Delete bool
+}
+
+// SetBuffer stores content in the named paste buffer, replacing any existing
+// content. The content is passed on stdin so it can be arbitrarily large.
+func SetBuffer(ctx context.Context, bufferName, content string) error {
+	if bufferName == "" {
+		return fmt.Errorf("buffer name must not be empty")
+	}
+
+	if _, err := runWithInput(ctx, strings.NewReader(content), "load-buffer", "-b", bufferName, "-"); err != nil {
+		return fmt.Errorf("failed to set buffer: %w", err)
+	}
+	return nil
+}
+
+// PasteBuffer pastes the named buffer into a session
+func PasteBuffer(ctx context.Context, sessionName, bufferName string, opts PasteOptions) error {
+	args := []string{"paste-buffer", "-b", bufferName, "-t", sessionName}
+	if opts.Bracketed {
+		args = append(args, "-p")
+	}
+	if opts.Delete {
+		args = append(args, "-d")
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("failed to paste buffer: %w", err)
+	}
+	return nil
+}
+
+// GetBuffer returns the content of the named buffer
+func GetBuffer(ctx context.Context, bufferName string) (string, error) {
+	output, err := run(ctx, "show-buffer", "-b", bufferName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get buffer: %w", err)
+	}
+	return output, nil
+}
+
+// ListBuffers returns the paste buffers on the configured socket, most
+// recent first. A missing tmux server is reported as no buffers.
+func ListBuffers(ctx context.Context) ([]Buffer, error) {
+	output, err := run(ctx, "list-buffers", "-F", "#{buffer_name}\t#{buffer_size}\t#{buffer_sample}")
+	if err != nil {
+		if errors.Is(err, ErrNoServer) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list buffers: %w", err)
+	}
+
+	return parseBuffers(output), nil
+}
+
+// parseBuffers parses list-buffers output in name, size, sample form
+func parseBuffers(output string) []Buffer {
+	var buffers []Buffer
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		size, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		buffers = append(buffers, Buffer{Name: fields[0], Size: size, Sample: fields[2]})
+	}
+	return buffers
+}
@@ -0,0 +1,62 @@
+package tmux
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxSendBytes bounds the number of raw bytes sent in one step or call
+const MaxSendBytes = 4096
+
+// ParseHex decodes a hex string such as "1b5b41" or "1b 5b 41" into bytes.
+// Whitespace between digits is ignored.
+func ParseHex(s string) ([]byte, error) {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	if digits == "" {
+		return nil, fmt.Errorf("hex input is empty")
+	}
+	if len(digits)%2 != 0 {
+		return nil, fmt.Errorf("hex input %q has an odd number of digits", s)
+	}
+	if len(digits)/2 > MaxSendBytes {
+		return nil, fmt.Errorf("hex input is %d bytes, more than the limit of %d", len(digits)/2, MaxSendBytes)
+	}
+
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		if invalid, ok := err.(hex.InvalidByteError); ok {
+			return nil, fmt.Errorf("hex input %q contains invalid digit %q", s, rune(invalid))
+		}
+		return nil, fmt.Errorf("invalid hex input %q: %v", s, err)
+	}
+
+	return data, nil
+}
+
+// hexArgs returns send-keys -H arguments, one per byte
+func hexArgs(data []byte) []string {
+	args := make([]string, len(data))
+	for i, b := range data {
+		args[i] = fmt.Sprintf("%02x", b)
+	}
+	return args
+}
+
+// SendBytes sends raw bytes to a session, bypassing tmux's key names
+func SendBytes(ctx context.Context, sessionName string, data []byte) error {
+	if len(data) > MaxSendBytes {
+		return fmt.Errorf("cannot send %d bytes, more than the limit of %d", len(data), MaxSendBytes)
+	}
+
+	_, err := run(ctx, append([]string{"send-keys", "-t", sessionName, "-H"}, hexArgs(data)...)...)
+	return err
+}
@@ -0,0 +1,219 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SendOptions controls how SendCommands runs a sequence
+type SendOptions struct {
+	// DefaultDelay is applied after every step except sleeps
+	DefaultDelay time.Duration
+	// CaptureScreen appends the final screen content to the result
+	CaptureScreen bool
+	// Progress, if set, is called after each completed step
+	Progress func(Progress)
+	// SnapshotInterval, if set, attaches a screen capture to progress reports
+	// at most this often
+	SnapshotInterval time.Duration
+	// TypingDelay, if set, types every text step a character at a time with
+	// this delay between characters. It also sets the pace of <TYPE_SLOW>.
+	TypingDelay time.Duration
+}
+
+// typingDelay is the per-character delay of <TYPE_SLOW> steps
+func (o SendOptions) typingDelay() time.Duration {
+	if o.TypingDelay > 0 {
+		return o.TypingDelay
+	}
+	return DefaultTypingDelay
+}
+
+// Progress describes how far a SendCommands run has got
+type Progress struct {
+	// Step counts the steps completed so far, each loop iteration's
+	// included, so it only ever increases
+	Step int
+	// Total is the length of the sequence, or 0 once a loop has repeated
+	// steps and the number that will run is unknown
+	Total   int
+	Text    string
+	Elapsed time.Duration
+	// Screen holds a capture of the pane when a snapshot was due
+	Screen string
+}
+
+// SendCommands sends a sequence of parsed steps to a session. <IF> and
+// <UNTIL> blocks are evaluated against live captures of the pane, and their
+// outcomes are listed in a trace in the result. If ctx is cancelled or a step
+// fails, the returned *SequenceError records how many steps completed.
+func SendCommands(ctx context.Context, sessionName string, steps []Step, opts SendOptions) (string, error) {
+	var result strings.Builder
+
+	result.WriteString(fmt.Sprintf("Executing %d commands on session '%s':\n", len(steps), sessionName))
+
+	blocks, problems := matchBlocks(steps)
+	if len(problems) > 0 {
+		return "", &StepsError{Problems: problems}
+	}
+
+	start := time.Now()
+	var lastSnapshot time.Time
+	var trace []string
+	iterations := map[int]int{}
+
+	// executed counts the steps run; i is the position in the sequence and
+	// moves back when a loop repeats
+	executed := 0
+	total := len(steps)
+
+	slow := &typist{sessionName: sessionName}
+	defer slow.Close()
+
+	for i := 0; i < len(steps); i++ {
+		step := steps[i]
+
+		switch step.Kind {
+		case StepIf:
+			matched, err := screenMatches(ctx, sessionName, step.Condition)
+			if err != nil {
+				return "", &SequenceError{Completed: executed, Total: total, Step: step.String(), Err: err}
+			}
+			if matched {
+				trace = append(trace, fmt.Sprintf("%d. %s matched", i+1, step))
+			} else {
+				trace = append(trace, fmt.Sprintf("%d. %s did not match, skipped to step %d", i+1, step, blocks[i]+2))
+				i = blocks[i]
+			}
+			continue
+
+		case StepUntil:
+			matched, err := screenMatches(ctx, sessionName, step.Condition)
+			if err != nil {
+				return "", &SequenceError{Completed: executed, Total: total, Step: step.String(), Err: err}
+			}
+			if matched {
+				trace = append(trace, fmt.Sprintf("%d. %s matched after %d iterations", i+1, step, iterations[i]))
+				delete(iterations, i)
+				i = blocks[i]
+				continue
+			}
+			if iterations[i] >= step.Max {
+				err := fmt.Errorf("%w: screen did not match %s after %d iterations", ErrConditionNotMet, step.Condition, step.Max)
+				return "", &SequenceError{Completed: executed, Total: total, Step: step.String(), Err: err}
+			}
+			iterations[i]++
+			continue
+
+		case StepEnd:
+			// Loop back to re-test the condition
+			i = blocks[i] - 1
+			total = 0
+			continue
+
+		case StepEndIf:
+			continue
+		}
+
+		if err := executeStep(ctx, sessionName, step, opts, slow); err != nil {
+			return "", &SequenceError{Completed: executed, Total: total, Step: step.String(), Err: err}
+		}
+		executed++
+
+		// Apply default delay after steps that sent input
+		if opts.DefaultDelay > 0 && step.sendsInput() {
+			if err := sleep(ctx, opts.DefaultDelay); err != nil {
+				return "", &SequenceError{Completed: executed, Total: total, Err: err}
+			}
+		}
+
+		if opts.Progress != nil {
+			progress := Progress{Step: executed, Total: total, Text: step.String(), Elapsed: time.Since(start)}
+			if opts.SnapshotInterval > 0 && time.Since(lastSnapshot) >= opts.SnapshotInterval {
+				if screen, err := CapturePane(ctx, sessionName); err == nil {
+					progress.Screen = screen
+					lastSnapshot = time.Now()
+				}
+			}
+			opts.Progress(progress)
+		}
+	}
+
+	result.WriteString("Commands executed successfully.\n")
+
+	if len(trace) > 0 {
+		result.WriteString("\nTrace:\n")
+		for _, line := range trace {
+			result.WriteString(line + "\n")
+		}
+	}
+
+	// Capture screen if requested
+	if opts.CaptureScreen {
+		content, err := CapturePane(ctx, sessionName)
+		if err != nil {
+			result.WriteString(fmt.Sprintf("Warning: Failed to capture screen: %v\n", err))
+		} else {
+			result.WriteString("\nScreen content:\n")
+			result.WriteString(content)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// executeStep performs a single step against the session
+func executeStep(ctx context.Context, sessionName string, step Step, opts SendOptions, slow *typist) error {
+	switch step.Kind {
+	case StepSleep:
+		return sleep(ctx, step.Duration)
+	case StepMouse:
+		return SendMouse(ctx, sessionName, step.Mouse)
+	case StepTypeSlow:
+		return slow.typeText(ctx, step.Text, opts.typingDelay())
+	case StepWaitIdle:
+		_, err := WaitForIdle(ctx, sessionName, step.Duration, step.Timeout)
+		return err
+	case StepText:
+		if opts.TypingDelay > 0 {
+			return slow.typeText(ctx, step.Text, opts.TypingDelay)
+		}
+	}
+
+	_, err := run(ctx, step.Invocation(sessionName)...)
+	return err
+}
+
+// parseSleep parses <SLEEP Xms> or <SLEEP Xs> commands
+func parseSleep(cmd string) (time.Duration, error) {
+	// Parse "SLEEP 500ms" or "SLEEP 2s"
+	parts := strings.Split(cmd, " ")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid sleep command format: %s", cmd)
+	}
+
+	timeStr := parts[1]
+
+	if strings.HasSuffix(timeStr, "ms") {
+		ms := strings.TrimSuffix(timeStr, "ms")
+		msInt, err := strconv.Atoi(ms)
+		if err != nil {
+			return 0, fmt.Errorf("invalid milliseconds value: %s", ms)
+		}
+		return time.Duration(msInt) * time.Millisecond, nil
+	}
+
+	if strings.HasSuffix(timeStr, "s") {
+		s := strings.TrimSuffix(timeStr, "s")
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seconds value: %s", s)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	return 0, fmt.Errorf("sleep time must end with 'ms' or 's': %s", timeStr)
+}
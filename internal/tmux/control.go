@@ -0,0 +1,113 @@
+package tmux
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// controlClient is a tmux control mode (-C) connection to a session, used to
+// send many small commands without starting a tmux process for each one
+type controlClient struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines *bufio.Scanner
+}
+
+// openControlClient attaches a control mode client to a session. The client
+// asks for no output and does not affect the session's size.
+func openControlClient(ctx context.Context, sessionName string) (*controlClient, error) {
+	if err := requireFeature(FeatureControlFlags); err != nil {
+		return nil, err
+	}
+
+	cmd := tmuxCommand(ctx, "-C", "attach-session", "-f", "no-output,ignore-size", "-t", sessionName)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start control client: %v", err)
+	}
+
+	c := &controlClient{cmd: cmd, stdin: stdin, lines: bufio.NewScanner(stdout)}
+
+	// The attach itself is answered like any other command
+	if err := c.wait([]string{"attach-session"}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// run sends one command and waits for tmux to finish it
+func (c *controlClient) run(args ...string) error {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = controlQuote(arg)
+	}
+
+	if _, err := fmt.Fprintf(c.stdin, "%s\n", strings.Join(quoted, " ")); err != nil {
+		return fmt.Errorf("control client: %v", err)
+	}
+	return c.wait(args)
+}
+
+// wait reads up to the %end or %error that closes the next command's reply,
+// skipping notifications
+func (c *controlClient) wait(args []string) error {
+	var output []string
+	inReply := false
+
+	for c.lines.Scan() {
+		line := c.lines.Text()
+		switch {
+		case strings.HasPrefix(line, "%begin "):
+			inReply = true
+			output = nil
+		case strings.HasPrefix(line, "%end "):
+			return nil
+		case strings.HasPrefix(line, "%error "):
+			return newCommandError(args, strings.Join(output, "\n"), errors.New("control mode command failed"))
+		case strings.HasPrefix(line, "%exit"):
+			return newCommandError(args, strings.TrimSpace(strings.TrimPrefix(line, "%exit")), errors.New("control client exited"))
+		case inReply:
+			output = append(output, line)
+		}
+	}
+
+	if err := c.lines.Err(); err != nil {
+		return fmt.Errorf("control client: %v", err)
+	}
+	return fmt.Errorf("control client: connection closed")
+}
+
+// Close detaches the control client
+func (c *controlClient) Close() error {
+	_ = c.stdin.Close()
+	return c.cmd.Wait()
+}
+
+// controlQuote quotes an argument for tmux's command parser. Control
+// characters cannot be written on a control mode command line.
+func controlQuote(arg string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '\\', '"', '$':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,13 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlQuote(t *testing.T) {
+	assert.Equal(t, `"plain"`, controlQuote("plain"))
+	assert.Equal(t, `"say \"hi\" to \$USER \\ ok"`, controlQuote(`say "hi" to $USER \ ok`))
+	assert.Equal(t, `"; kill-server"`, controlQuote("; kill-server"))
+}
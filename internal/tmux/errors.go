@@ -0,0 +1,167 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors reported by tmux, classified from its stderr
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrTargetNotFound     = errors.New("window or pane not found")
+	ErrDuplicateSession   = errors.New("duplicate session")
+	ErrNoServer           = errors.New("no tmux server running")
+	ErrBufferNotFound     = errors.New("buffer not found")
+	ErrUnsupported        = errors.New("unsupported by this tmux")
+	ErrMouseDisabled      = errors.New("the application in the pane has not enabled mouse reporting")
+	ErrNoShellIntegration = errors.New("shell integration is not enabled for this session")
+)
+
+// Error codes returned to MCP clients by ErrorCode
+const (
+	CodeSessionNotFound    = "SESSION_NOT_FOUND"
+	CodeTargetNotFound     = "TARGET_NOT_FOUND"
+	CodeDuplicateSession   = "DUPLICATE_SESSION"
+	CodeNoServer           = "NO_SERVER"
+	CodeBufferNotFound     = "BUFFER_NOT_FOUND"
+	CodeUnsupported        = "UNSUPPORTED"
+	CodeMouseDisabled      = "MOUSE_DISABLED"
+	CodeConditionNotMet    = "CONDITION_NOT_MET"
+	CodeNoShellIntegration = "NO_SHELL_INTEGRATION"
+	CodeInvalidSteps       = "INVALID_STEPS"
+	CodeTimeout            = "TIMEOUT"
+	CodeCancelled          = "CANCELLED"
+	CodeTmuxError          = "TMUX_ERROR"
+)
+
+// CommandError is a failed tmux invocation along with what tmux printed
+type CommandError struct {
+	Args   []string
+	Stderr string
+	Kind   error
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	msg := e.Stderr
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+
+	if len(e.Args) > 0 {
+		return fmt.Sprintf("tmux %s: %s", e.Args[0], msg)
+	}
+	return "tmux: " + msg
+}
+
+// Unwrap exposes both the classified kind and the underlying exec error
+func (e *CommandError) Unwrap() []error {
+	if e.Kind != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Err}
+}
+
+// SequenceError reports a command sequence that stopped part way through,
+// either because a step failed or because the context was done
+type SequenceError struct {
+	// Completed counts the steps run, each loop iteration's included
+	Completed int
+	// Total is the length of the sequence, or 0 once a loop has repeated
+	// steps and the number that will run is unknown
+	Total int
+	Step  string
+	Err   error
+}
+
+func (e *SequenceError) Error() string {
+	completed := fmt.Sprintf("%d steps completed", e.Completed)
+	if e.Total > 0 {
+		completed = fmt.Sprintf("%d of %d steps completed", e.Completed, e.Total)
+	}
+	if e.Step != "" {
+		return fmt.Sprintf("step %d ('%s') failed after %s: %v", e.Completed+1, e.Step, completed, e.Err)
+	}
+	return fmt.Sprintf("stopped after %s: %v", completed, e.Err)
+}
+
+func (e *SequenceError) Unwrap() error {
+	return e.Err
+}
+
+// newCommandError classifies a failed tmux invocation from its stderr
+func newCommandError(args []string, stderr string, err error) *CommandError {
+	stderr = strings.TrimSpace(stderr)
+	return &CommandError{
+		Args:   args,
+		Stderr: stderr,
+		Kind:   classifyStderr(stderr),
+		Err:    err,
+	}
+}
+
+// classifyStderr maps tmux's error messages onto the package's error kinds
+func classifyStderr(stderr string) error {
+	switch {
+	case strings.HasPrefix(stderr, "duplicate session"):
+		return ErrDuplicateSession
+	case strings.HasPrefix(stderr, "can't find session"), strings.HasPrefix(stderr, "session not found"):
+		return ErrSessionNotFound
+	case strings.HasPrefix(stderr, "can't find pane"), strings.HasPrefix(stderr, "can't find window"):
+		// A bare target such as "dev" that fails to resolve is a missing session
+		target := strings.TrimSpace(stderr[strings.Index(stderr, ":")+1:])
+		if !strings.ContainsAny(target, ":.%@") {
+			return ErrSessionNotFound
+		}
+		return ErrTargetNotFound
+	case isNoServer(stderr):
+		return ErrNoServer
+	case strings.HasPrefix(stderr, "no buffer"):
+		return ErrBufferNotFound
+	case strings.HasPrefix(stderr, "unknown command"), strings.Contains(stderr, "unknown flag"), strings.Contains(stderr, "unknown option"):
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// isNoServer reports whether tmux stderr says no server is running on the socket
+func isNoServer(stderr string) bool {
+	return strings.Contains(stderr, "no server running") ||
+		strings.Contains(stderr, "error connecting to") ||
+		strings.Contains(stderr, "server exited unexpectedly")
+}
+
+// ErrorCode returns a stable, machine-readable code for an error from this package
+func ErrorCode(err error) string {
+	var unsupported *UnsupportedError
+	var invalidSteps *StepsError
+	switch {
+	case errors.As(err, &invalidSteps):
+		return CodeInvalidSteps
+	case errors.Is(err, ErrSessionNotFound):
+		return CodeSessionNotFound
+	case errors.Is(err, ErrTargetNotFound):
+		return CodeTargetNotFound
+	case errors.Is(err, ErrDuplicateSession):
+		return CodeDuplicateSession
+	case errors.Is(err, ErrNoServer):
+		return CodeNoServer
+	case errors.Is(err, ErrBufferNotFound):
+		return CodeBufferNotFound
+	case errors.Is(err, ErrConditionNotMet):
+		return CodeConditionNotMet
+	case errors.Is(err, ErrMouseDisabled):
+		return CodeMouseDisabled
+	case errors.Is(err, ErrNoShellIntegration):
+		return CodeNoShellIntegration
+	case errors.Is(err, ErrUnsupported), errors.As(err, &unsupported):
+		return CodeUnsupported
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCancelled
+	}
+	return CodeTmuxError
+}
@@ -0,0 +1,53 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"duplicate session: dev", ErrDuplicateSession},
+		{"can't find session: dev", ErrSessionNotFound},
+		{"can't find pane: dev", ErrSessionNotFound},
+		{"can't find pane: 7", ErrSessionNotFound},
+		{"can't find window: dev:5", ErrTargetNotFound},
+		{"no server running on /tmp/tmux-0/default", ErrNoServer},
+		{"error connecting to /tmp/tmux-0/agents (No such file or directory)", ErrNoServer},
+		{"no buffer nob", ErrBufferNotFound},
+		{"command send-keys: unknown flag -H", ErrUnsupported},
+		{"something else", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, classifyStderr(tt.stderr), tt.stderr)
+	}
+}
+
+func TestCommandErrorWrapping(t *testing.T) {
+	err := newCommandError([]string{"kill-session", "-t", "dev"}, "can't find session: dev\n", &exec.ExitError{})
+	wrapped := fmt.Errorf("failed to close: %w", err)
+
+	assert.True(t, errors.Is(wrapped, ErrSessionNotFound))
+	assert.Equal(t, CodeSessionNotFound, ErrorCode(wrapped))
+	assert.Equal(t, "tmux kill-session: can't find session: dev", err.Error())
+	assert.Equal(t, CodeUnsupported, ErrorCode(&UnsupportedError{Feature: FeatureControlFlags}))
+	assert.Equal(t, CodeTmuxError, ErrorCode(errors.New("boom")))
+}
+
+func TestSequenceErrorMessage(t *testing.T) {
+	err := &SequenceError{Completed: 1, Total: 3, Step: "<ENTER>", Err: errors.New("boom")}
+	assert.Equal(t, "step 2 ('<ENTER>') failed after 1 of 3 steps completed: boom", err.Error())
+
+	// Once a loop has repeated steps the total is unknown
+	err = &SequenceError{Completed: 7, Err: context.Canceled}
+	assert.Equal(t, "stopped after 7 steps completed: context canceled", err.Error())
+}
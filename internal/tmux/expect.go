@@ -0,0 +1,380 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// expectPollInterval is how often Expect captures the pane
+const expectPollInterval = 100 * time.Millisecond
+
+// DefaultMaxResponses bounds how many prompts Expect answers by default
+const DefaultMaxResponses = 50
+
+// ExpectRule answers a prompt: when Pattern appears, Send is sent
+type ExpectRule struct {
+	Pattern Condition
+	Send    []Step
+	// Timeout is how long to wait for the next prompt after answering this
+	// one; zero uses ExpectOptions.Timeout
+	Timeout time.Duration
+}
+
+// ExpectOptions controls an Expect run
+type ExpectOptions struct {
+	// Start is sent before waiting for the first prompt, e.g. the command
+	// that asks the questions. Its last step submits it, like the Enter
+	// after a command, and the line it was typed on is not matched.
+	Start []Step
+	// End finishes the run successfully when it appears
+	End Condition
+	// Timeout is how long to wait for the first prompt, and for later ones
+	// unless the rule answered sets its own
+	Timeout time.Duration
+	// MaxResponses stops a run that keeps answering prompts
+	MaxResponses int
+}
+
+// ExpectEvent is one prompt that was matched and answered
+type ExpectEvent struct {
+	// Rule is the 1-based index of the matching rule
+	Rule    int
+	Prompt  string
+	Sent    string
+	Elapsed time.Duration
+}
+
+// ExpectResult is the transcript of an Expect run
+type ExpectResult struct {
+	Events []ExpectEvent
+	// Ended is set when the end pattern appeared
+	Ended   bool
+	Elapsed time.Duration
+	Screen  string
+}
+
+// Transcript renders the matched prompts and responses, one per line
+func (r ExpectResult) Transcript() string {
+	var b strings.Builder
+	for _, e := range r.Events {
+		b.WriteString(fmt.Sprintf("[%s] rule %d matched %s, sent %s\n", e.Elapsed.Round(time.Millisecond), e.Rule, strconv.Quote(e.Prompt), e.Sent))
+	}
+	if r.Ended {
+		b.WriteString(fmt.Sprintf("[%s] end pattern matched\n", r.Elapsed.Round(time.Millisecond)))
+	}
+	return b.String()
+}
+
+// ValidateResponse checks that steps can be sent as an expect response,
+// which allows input and sleeps but not control flow
+func ValidateResponse(steps []Step) error {
+	for i, step := range steps {
+		if !step.sendsInput() && step.Kind != StepSleep {
+			return fmt.Errorf("step %d: %s cannot be used in an expect response", i+1, step)
+		}
+	}
+	return nil
+}
+
+// Expect answers prompts in a session until the end pattern appears. Only
+// output from the cursor's line onwards when the run starts, or below the
+// line Start was typed on, is matched, and each prompt is answered once:
+// matching resumes after the end of the last match. The result is returned
+// along with any error so the transcript is never lost.
+func Expect(ctx context.Context, sessionName string, rules []ExpectRule, opts ExpectOptions) (ExpectResult, error) {
+	var result ExpectResult
+	start := time.Now()
+
+	if opts.MaxResponses <= 0 {
+		opts.MaxResponses = DefaultMaxResponses
+	}
+	if err := ValidateResponse(opts.Start); err != nil {
+		return result, err
+	}
+	for _, rule := range rules {
+		if err := ValidateResponse(rule.Send); err != nil {
+			return result, err
+		}
+	}
+
+	slow := &typist{sessionName: sessionName}
+	defer slow.Close()
+
+	// Skip everything above the cursor, so old prompts aren't answered again
+	last, err := captureTranscript(ctx, sessionName)
+	if err != nil {
+		return result, err
+	}
+	mark := position{line: last.cursor}
+	echo := typedLine(opts.Start)
+
+	if n := len(opts.Start); n > 0 {
+		// The command line is echoed where it is typed, so it must not be
+		// matched itself: once all but the submitting last step are sent,
+		// matching starts on the line after the cursor's
+		if err := sendResponse(ctx, sessionName, opts.Start[:n-1], slow); err != nil {
+			return result, err
+		}
+		typed, err := captureTranscript(ctx, sessionName)
+		if err != nil {
+			return result, err
+		}
+		if err := sendResponse(ctx, sessionName, opts.Start[n-1:], slow); err != nil {
+			return result, err
+		}
+		if last, err = captureTranscript(ctx, sessionName); err != nil {
+			return result, err
+		}
+		mark = last.follow(typed, position{line: typed.cursor + 1})
+	}
+
+	timeout := opts.Timeout
+	deadline := time.Now().Add(timeout)
+
+	for {
+		current, err := captureTranscript(ctx, sessionName)
+		if err != nil {
+			return result, err
+		}
+		result.Screen = strings.TrimRight(strings.Join(current.screen, "\n"), "\n")
+
+		mark = current.follow(last, mark)
+		if echo != "" && len(result.Events) == 0 {
+			mark = current.skipEcho(mark, echo)
+		}
+		last = current
+		pending := current.after(mark)
+
+		// The earliest match wins, whether it is a prompt or the end
+		rule, loc := -1, []int(nil)
+		for i, r := range rules {
+			if m := r.Pattern.Regexp.FindStringIndex(pending); m != nil && (loc == nil || m[0] < loc[0]) {
+				rule, loc = i, m
+			}
+		}
+		if m := opts.End.Regexp.FindStringIndex(pending); m != nil && (loc == nil || m[0] <= loc[0]) {
+			result.Ended = true
+			result.Elapsed = time.Since(start)
+			return result, nil
+		}
+
+		if rule >= 0 {
+			if len(result.Events) >= opts.MaxResponses {
+				result.Elapsed = time.Since(start)
+				return result, fmt.Errorf("%w: answered %d prompts without seeing the end pattern %s", ErrConditionNotMet, len(result.Events), opts.End)
+			}
+
+			mark = current.advance(mark, pending[:loc[1]])
+			sent := make([]string, len(rules[rule].Send))
+			for i, step := range rules[rule].Send {
+				sent[i] = step.String()
+			}
+			result.Events = append(result.Events, ExpectEvent{
+				Rule:    rule + 1,
+				Prompt:  strings.TrimSpace(pending[loc[0]:loc[1]]),
+				Sent:    strings.Join(sent, " "),
+				Elapsed: time.Since(start),
+			})
+
+			if err := sendResponse(ctx, sessionName, rules[rule].Send, slow); err != nil {
+				result.Elapsed = time.Since(start)
+				return result, err
+			}
+
+			timeout = opts.Timeout
+			if rules[rule].Timeout > 0 {
+				timeout = rules[rule].Timeout
+			}
+			deadline = time.Now().Add(timeout)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			result.Elapsed = time.Since(start)
+			return result, fmt.Errorf("%w: no prompt or end pattern %s appeared within %s", ErrConditionNotMet, opts.End, timeout)
+		}
+		if err := sleep(ctx, expectPollInterval); err != nil {
+			result.Elapsed = time.Since(start)
+			return result, err
+		}
+	}
+}
+
+// sendResponse sends the steps of a response, pausing briefly after input
+// so the pane can react before the next capture
+func sendResponse(ctx context.Context, sessionName string, steps []Step, slow *typist) error {
+	for _, step := range steps {
+		if err := executeStep(ctx, sessionName, step, SendOptions{}, slow); err != nil {
+			return err
+		}
+	}
+	if len(steps) > 0 {
+		return sleep(ctx, expectPollInterval)
+	}
+	return nil
+}
+
+// position is how far Expect has read: a line of a transcript and a byte
+// offset into it. The text before the offset is kept to notice the line
+// being rewritten.
+type position struct {
+	line   int
+	col    int
+	prefix string
+}
+
+// transcript is a capture of a pane as lines, with wrapped lines joined
+type transcript struct {
+	// history holds the scrollback, whose lines no longer change but drop
+	// off the top once history-limit is reached
+	history []string
+	screen  []string
+	// cursor is the index in lines of the line holding the cursor
+	cursor int
+}
+
+// lines returns the scrollback followed by the screen
+func (t transcript) lines() []string {
+	return append(slices.Clip(t.history), t.screen...)
+}
+
+// follow moves a position taken in an earlier capture to the same place in
+// this one. Lines dropped from the scrollback are accounted for by lining up
+// the two scrollbacks; when that fails or the line was rewritten, matching
+// resumes from the start of the cursor's line rather than the top, so
+// prompts still on screen aren't answered again.
+func (t transcript) follow(earlier transcript, p position) position {
+	dropped := droppedLines(earlier.history, t.history)
+	if dropped < 0 {
+		return position{line: t.cursor}
+	}
+
+	p.line -= dropped
+	if p.line < 0 {
+		// Everything after the position scrolled through, and some of it away
+		return position{}
+	}
+
+	lines := t.lines()
+	if p.line >= len(lines) || !strings.HasPrefix(lines[p.line], p.prefix) {
+		return position{line: t.cursor}
+	}
+	return p
+}
+
+// after returns the text following a position
+func (t transcript) after(p position) string {
+	lines := t.lines()
+	if p.line >= len(lines) {
+		return ""
+	}
+	return strings.Join(lines[p.line:], "\n")[p.col:]
+}
+
+// advance moves a position past consumed, text that followed it
+func (t transcript) advance(p position, consumed string) position {
+	if i := strings.LastIndexByte(consumed, '\n'); i >= 0 {
+		p.line += strings.Count(consumed, "\n")
+		p.col = len(consumed) - i - 1
+	} else {
+		p.col += len(consumed)
+	}
+	p.prefix = t.lines()[p.line][:p.col]
+	return p
+}
+
+// skipEcho moves a position below the last line at or after it that ends
+// with the typed command line. A command typed before the shell is ready is
+// echoed again under its prompt once it is, below the line Expect skipped.
+func (t transcript) skipEcho(p position, command string) position {
+	lines := t.lines()
+	for i := len(lines) - 1; i >= p.line; i-- {
+		line := strings.TrimRight(lines[i], " ")
+		if line == command || strings.HasSuffix(line, " "+command) {
+			return position{line: i + 1}
+		}
+	}
+	return p
+}
+
+// typedLine returns the last line of text typed by steps, as a shell would
+// echo it
+func typedLine(steps []Step) string {
+	var typed strings.Builder
+	for _, step := range steps {
+		if step.Kind == StepText || step.Kind == StepTypeSlow {
+			typed.WriteString(step.Text)
+		}
+	}
+	text := strings.TrimRight(typed.String(), "\n")
+	return strings.TrimSpace(text[strings.LastIndexByte(text, '\n')+1:])
+}
+
+// droppedLines returns how many lines left the top of the scrollback between
+// two captures of it, or -1 when the later one doesn't continue the earlier
+// one, as after clear-history
+func droppedLines(earlier, later []string) int {
+	if len(later) == 0 && len(earlier) > 0 {
+		return -1
+	}
+	for dropped := range len(earlier) + 1 {
+		rest := earlier[dropped:]
+		n := min(len(rest), len(later))
+		if slices.Equal(rest[:n], later[:n]) {
+			return dropped
+		}
+	}
+	return -1
+}
+
+// cursorLine returns the index of the joined screen line holding the row the
+// cursor is on, given the pane's width
+func cursorLine(screen []string, row, width int) int {
+	for i, line := range screen {
+		rows := 1
+		if width > 0 {
+			rows = max(1, (utf8.RuneCountInString(line)+width-1)/width)
+		}
+		if row < rows {
+			return i
+		}
+		row -= rows
+	}
+	return max(0, len(screen)-1)
+}
+
+// captureTranscript captures the pane's scrollback and visible screen
+func captureTranscript(ctx context.Context, sessionName string) (transcript, error) {
+	var t transcript
+
+	output, err := run(ctx, "display-message", "-p", "-t", sessionName, "#{history_size} #{cursor_y} #{pane_width}")
+	if err != nil {
+		return t, fmt.Errorf("failed to read pane state: %w", err)
+	}
+	var size, row, width int
+	if _, err := fmt.Sscan(output, &size, &row, &width); err != nil {
+		return t, fmt.Errorf("unexpected pane state %q", strings.TrimSpace(output))
+	}
+
+	if size > 0 {
+		history, err := run(ctx, "capture-pane", "-p", "-J", "-t", sessionName, "-S", "-", "-E", "-1")
+		if err != nil {
+			return t, fmt.Errorf("failed to capture history: %w", err)
+		}
+		t.history = strings.Split(strings.TrimSuffix(history, "\n"), "\n")
+	}
+
+	screen, err := run(ctx, "capture-pane", "-p", "-J", "-t", sessionName)
+	if err != nil {
+		return t, fmt.Errorf("failed to capture screen: %w", err)
+	}
+	t.screen = strings.Split(strings.TrimSuffix(screen, "\n"), "\n")
+	t.cursor = len(t.history) + cursorLine(t.screen, row, width)
+
+	return t, nil
+}
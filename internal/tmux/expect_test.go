@@ -0,0 +1,72 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDroppedLines(t *testing.T) {
+	assert.Equal(t, 0, droppedLines(nil, nil))
+	assert.Equal(t, 0, droppedLines(nil, []string{"a"}))
+	assert.Equal(t, 0, droppedLines([]string{"a", "b"}, []string{"a", "b", "c"}))
+	assert.Equal(t, 2, droppedLines([]string{"a", "b", "c"}, []string{"c", "d", "e"}))
+	assert.Equal(t, 1, droppedLines([]string{"$ x", "$ x"}, []string{"$ x", "y"}), "repeated lines line up at the smallest shift that fits")
+	assert.Equal(t, 2, droppedLines([]string{"a", "b"}, []string{"c", "d"}), "everything scrolled away")
+	assert.Equal(t, -1, droppedLines([]string{"a", "b"}, nil), "cleared history")
+}
+
+func TestCursorLine(t *testing.T) {
+	screen := []string{"$ long", "0123456789ab", "$ ", ""}
+	assert.Equal(t, 0, cursorLine(screen, 0, 10))
+	assert.Equal(t, 1, cursorLine(screen, 1, 10))
+	assert.Equal(t, 1, cursorLine(screen, 2, 10), "wrapped lines take two rows")
+	assert.Equal(t, 2, cursorLine(screen, 3, 10))
+	assert.Equal(t, 3, cursorLine(screen, 9, 10))
+}
+
+func TestTranscriptPosition(t *testing.T) {
+	first := transcript{history: []string{"old 1", "old 2"}, screen: []string{"Name: bob", "Name: "}, cursor: 3}
+	mark := position{line: first.cursor}
+	assert.Equal(t, "Name: ", first.after(mark))
+
+	mark = first.advance(mark, "Name:")
+	assert.Equal(t, position{line: 3, col: 5, prefix: "Name:"}, mark)
+
+	// The history filled up and dropped its oldest line
+	second := transcript{history: []string{"old 2", "Name: bob"}, screen: []string{"Name: alice", "Age: "}, cursor: 3}
+	mark = second.follow(first, mark)
+	assert.Equal(t, position{line: 2, col: 5, prefix: "Name:"}, mark)
+	assert.Equal(t, " alice\nAge: ", second.after(mark))
+
+	mark = second.advance(mark, " alice\nAge:")
+	assert.Equal(t, position{line: 3, col: 4, prefix: "Age:"}, mark)
+
+	// After the history is cleared, matching resumes at the cursor's line
+	third := transcript{screen: []string{"Age: 42", "Done"}, cursor: 1}
+	assert.Equal(t, position{line: 1}, third.follow(second, mark))
+
+	// A rewritten line also resumes at the cursor's line
+	fourth := transcript{history: []string{"old 2", "Name: bob"}, screen: []string{"Name: alice", "Password: "}, cursor: 3}
+	assert.Equal(t, position{line: 3}, fourth.follow(second, mark))
+}
+
+func TestSkipEcho(t *testing.T) {
+	// The command was typed ahead of the shell, which echoed it again under
+	// its prompt once it started
+	tr := transcript{screen: []string{"./serve --log listening", "loading profile", "$ ./serve --log listening", "", ""}, cursor: 3}
+	assert.Equal(t, position{line: 3}, tr.skipEcho(position{line: 1}, "./serve --log listening"))
+	assert.Equal(t, position{line: 4, col: 2}, tr.skipEcho(position{line: 4, col: 2}, "./serve --log listening"), "nothing is skipped below the position")
+
+	out := transcript{screen: []string{"$ ls", "notes.ls", ""}, cursor: 2}
+	assert.Equal(t, position{line: 1}, out.skipEcho(position{line: 1}, "ls"), "output that merely ends with the command's text doesn't count")
+}
+
+func TestTypedLine(t *testing.T) {
+	enter, err := ParseKey("ENTER")
+	require.NoError(t, err)
+	assert.Equal(t, "make run", typedLine([]Step{{Kind: StepText, Text: "make run "}, {Kind: StepKey, Key: enter}}))
+	assert.Equal(t, "second", typedLine([]Step{{Kind: StepText, Text: "first\nsecond\n"}}))
+	assert.Equal(t, "", typedLine([]Step{{Kind: StepKey, Key: enter}}))
+}
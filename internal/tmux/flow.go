@@ -0,0 +1,178 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultLoopMax is the iteration limit of an <UNTIL> loop without max=N
+const DefaultLoopMax = 10
+
+// MaxLoopIterations bounds max=N on <UNTIL> loops
+const MaxLoopIterations = 1000
+
+// ErrConditionNotMet is returned when an <UNTIL> loop runs out of iterations
+var ErrConditionNotMet = errors.New("condition not met")
+
+// Condition is a regular expression matched against the pane's text
+type Condition struct {
+	// Source is the pattern as written between the slashes
+	Source string
+	// Flags are the trailing flags, such as "i"
+	Flags  string
+	Regexp *regexp.Regexp
+}
+
+// String renders the condition as /pattern/flags
+func (c Condition) String() string {
+	return "/" + c.Source + "/" + c.Flags
+}
+
+// NewCondition compiles a bare regular expression, without slashes
+func NewCondition(pattern string) (Condition, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid pattern /%s/: %v", pattern, err)
+	}
+	return Condition{Source: pattern, Regexp: re}, nil
+}
+
+// parseCondition parses "/pattern/flags" at the start of s, returning the
+// rest of the string after it
+func parseCondition(s string) (Condition, string, error) {
+	if !strings.HasPrefix(s, "/") {
+		return Condition{}, "", fmt.Errorf("condition must be a regular expression written as /pattern/")
+	}
+
+	// Find the closing slash, skipping escaped ones
+	end := -1
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '/' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return Condition{}, "", fmt.Errorf("condition %q is missing its closing /", s)
+	}
+
+	c := Condition{Source: s[1:end]}
+	rest := s[end+1:]
+	for len(rest) > 0 && rest[0] != ' ' {
+		if rest[0] != 'i' {
+			return Condition{}, "", fmt.Errorf("unknown condition flag %q (only i is supported)", rest[0])
+		}
+		c.Flags += "i"
+		rest = rest[1:]
+	}
+
+	pattern := c.Source
+	if c.Flags != "" {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Condition{}, "", fmt.Errorf("invalid condition /%s/: %v", c.Source, err)
+	}
+	c.Regexp = re
+
+	return c, strings.TrimSpace(rest), nil
+}
+
+// parseIf parses "IF /pattern/"
+func parseIf(cmd string) (Step, error) {
+	cond, rest, err := parseCondition(strings.TrimPrefix(cmd, "IF "))
+	if err != nil {
+		return Step{}, err
+	}
+	if rest != "" {
+		return Step{}, fmt.Errorf("unexpected %q after <IF> condition", rest)
+	}
+	return Step{Kind: StepIf, Condition: cond}, nil
+}
+
+// parseUntil parses "UNTIL /pattern/ max=N"
+func parseUntil(cmd string) (Step, error) {
+	cond, rest, err := parseCondition(strings.TrimPrefix(cmd, "UNTIL "))
+	if err != nil {
+		return Step{}, err
+	}
+
+	step := Step{Kind: StepUntil, Condition: cond, Max: DefaultLoopMax}
+	if rest != "" {
+		value, ok := strings.CutPrefix(rest, "max=")
+		if !ok {
+			return Step{}, fmt.Errorf("unexpected %q after <UNTIL> condition, expected max=N", rest)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > MaxLoopIterations {
+			return Step{}, fmt.Errorf("max must be between 1 and %d, got %q", MaxLoopIterations, value)
+		}
+		step.Max = n
+	}
+	return step, nil
+}
+
+// blockNames names the block steps in structure errors
+var blockNames = map[StepKind]string{
+	StepIf:    "<IF>",
+	StepEndIf: "<ENDIF>",
+	StepUntil: "<UNTIL>",
+	StepEnd:   "<END>",
+}
+
+// matchBlocks pairs every <IF> with its <ENDIF> and every <UNTIL> with its
+// <END>, returning the partner index of each. Unbalanced blocks are reported
+// as problems with 1-based step indexes.
+func matchBlocks(steps []Step) (map[int]int, []StepProblem) {
+	partner := map[int]int{}
+	var open []int
+	var problems []StepProblem
+
+	for i, step := range steps {
+		switch step.Kind {
+		case StepIf, StepUntil:
+			open = append(open, i)
+		case StepEndIf, StepEnd:
+			want := StepIf
+			if step.Kind == StepEnd {
+				want = StepUntil
+			}
+			if len(open) == 0 || steps[open[len(open)-1]].Kind != want {
+				problems = append(problems, StepProblem{Index: i + 1, Err: fmt.Errorf("%s without a matching %s", blockNames[step.Kind], blockNames[want])})
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			partner[start] = i
+			partner[i] = start
+		}
+	}
+
+	for _, i := range open {
+		closer := StepEndIf
+		if steps[i].Kind == StepUntil {
+			closer = StepEnd
+		}
+		problems = append(problems, StepProblem{Index: i + 1, Err: fmt.Errorf("%s is never closed with %s", blockNames[steps[i].Kind], blockNames[closer])})
+	}
+
+	return partner, problems
+}
+
+// screenMatches captures the pane as plain text and tests the condition
+func screenMatches(ctx context.Context, sessionName string, cond Condition) (bool, error) {
+	screen, err := CapturePaneWithOptions(ctx, sessionName, CaptureOptions{Plain: true})
+	if err != nil {
+		return false, err
+	}
+	return cond.Regexp.MatchString(screen), nil
+}
@@ -0,0 +1,61 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// DefaultIdleQuiet is how long a pane must stay unchanged to count as idle
+const DefaultIdleQuiet = 500 * time.Millisecond
+
+// DefaultIdleMax bounds how long WaitForIdle waits by default
+const DefaultIdleMax = 60 * time.Second
+
+// IdleResult reports how long a pane took to go quiet
+type IdleResult struct {
+	Elapsed time.Duration
+	Screen  string
+}
+
+// WaitForIdle blocks until the pane's content and cursor have not changed
+// for quiet, or fails with ErrConditionNotMet once timeout has passed
+func WaitForIdle(ctx context.Context, sessionName string, quiet, timeout time.Duration) (IdleResult, error) {
+	start := time.Now()
+	interval := min(quiet/5, 100*time.Millisecond)
+	interval = max(interval, 10*time.Millisecond)
+
+	var last uint64
+	var screen string
+	changed := time.Now()
+
+	for {
+		state, err := run(ctx, "display-message", "-p", "-t", sessionName, "#{cursor_x},#{cursor_y}")
+		if err != nil {
+			return IdleResult{}, fmt.Errorf("failed to read cursor: %w", err)
+		}
+		screen, err = CapturePane(ctx, sessionName)
+		if err != nil {
+			return IdleResult{}, err
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(state))
+		h.Write([]byte(screen))
+		if sum := h.Sum64(); sum != last {
+			last = sum
+			changed = time.Now()
+		} else if time.Since(changed) >= quiet {
+			return IdleResult{Elapsed: time.Since(start), Screen: screen}, nil
+		}
+
+		if time.Since(start) >= timeout {
+			return IdleResult{Elapsed: time.Since(start), Screen: screen},
+				fmt.Errorf("%w: pane was still changing after %s", ErrConditionNotMet, timeout)
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return IdleResult{}, err
+		}
+	}
+}
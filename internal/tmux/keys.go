@@ -0,0 +1,247 @@
+package tmux
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxKeyRepeat bounds the repeat count in specs like DOWN*10
+const MaxKeyRepeat = 1000
+
+// namedKeys maps DSL key names to tmux key names
+var namedKeys = map[string]string{
+	"ENTER":     "Enter",
+	"ESC":       "Escape",
+	"ESCAPE":    "Escape",
+	"TAB":       "Tab",
+	"BTAB":      "BTab",
+	"BACKSPACE": "BSpace",
+	"DELETE":    "Delete",
+	"DEL":       "Delete",
+	"INSERT":    "IC",
+	"INS":       "IC",
+	"UP":        "Up",
+	"DOWN":      "Down",
+	"LEFT":      "Left",
+	"RIGHT":     "Right",
+	"HOME":      "Home",
+	"END":       "End",
+	"PAGEUP":    "PPage",
+	"PGUP":      "PPage",
+	"PAGEDOWN":  "NPage",
+	"PGDN":      "NPage",
+	"SPACE":     "Space",
+	"KPENTER":   "KPEnter",
+	"KP/":       "KP/",
+	"KP*":       "KP*",
+	"KP-":       "KP-",
+	"KP+":       "KP+",
+	"KP.":       "KP.",
+}
+
+func init() {
+	// tmux names F1-F12; F13-F24 are sent the way xterm does, as shifted F1-F12
+	for i := 1; i <= 24; i++ {
+		if i <= 12 {
+			namedKeys[fmt.Sprintf("F%d", i)] = fmt.Sprintf("F%d", i)
+		} else {
+			namedKeys[fmt.Sprintf("F%d", i)] = fmt.Sprintf("S-F%d", i-12)
+		}
+	}
+	for i := 0; i <= 9; i++ {
+		namedKeys[fmt.Sprintf("KP%d", i)] = fmt.Sprintf("KP%d", i)
+	}
+}
+
+// modifiers maps DSL modifier names to tmux prefixes
+var modifiers = map[string]string{
+	"CTRL":  "C",
+	"C":     "C",
+	"ALT":   "M",
+	"META":  "M",
+	"M":     "M",
+	"SHIFT": "S",
+	"S":     "S",
+}
+
+// Key is a parsed key press from the <KEY> DSL
+type Key struct {
+	// Spec is the key as written, without brackets or repeat count
+	Spec string
+	// Name is the tmux key name, e.g. "C-M-Delete"
+	Name string
+	// Repeat is how many times to press the key
+	Repeat int
+}
+
+// KeyError reports an unknown key, with close matches when there are any
+type KeyError struct {
+	Spec        string
+	Reason      string
+	Suggestions []string
+}
+
+func (e *KeyError) Error() string {
+	msg := fmt.Sprintf("invalid key <%s>: %s", e.Spec, e.Reason)
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(e.Suggestions, " or "))
+	}
+	return msg
+}
+
+// ParseKey parses a key spec without its angle brackets, such as "ENTER",
+// "F5", "SHIFT+TAB", "CTRL+ALT+DELETE", "CTRL+c" or "DOWN*10"
+func ParseKey(spec string) (Key, error) {
+	body, repeat, err := splitRepeat(spec)
+	if err != nil {
+		return Key{}, err
+	}
+
+	parts := strings.Split(body, "+")
+	// A trailing "+" is the plus key itself, as in CTRL++
+	if strings.HasSuffix(body, "++") {
+		parts = append(strings.Split(strings.TrimSuffix(body, "++"), "+"), "+")
+	}
+
+	base := parts[len(parts)-1]
+	if base == "" {
+		return Key{}, &KeyError{Spec: spec, Reason: "missing key after modifier"}
+	}
+
+	mods := map[string]bool{}
+	for _, part := range parts[:len(parts)-1] {
+		mod, ok := modifiers[strings.ToUpper(part)]
+		if !ok {
+			return Key{}, &KeyError{Spec: spec, Reason: fmt.Sprintf("unknown modifier %q", part), Suggestions: suggest(strings.ToUpper(part), modifierNames())}
+		}
+		mods[mod] = true
+	}
+
+	var name string
+	if utf8.RuneCountInString(base) == 1 {
+		if len(mods) == 0 {
+			return Key{}, &KeyError{Spec: spec, Reason: "single characters need a modifier such as CTRL+; send plain text as a literal step"}
+		}
+		name = base
+		if mods["C"] || mods["M"] {
+			// tmux spells control and meta letter keys in lower case
+			name = strings.ToLower(base)
+		}
+		if mods["S"] {
+			// Shifted characters are just their upper case form
+			name = strings.ToUpper(name)
+			delete(mods, "S")
+		}
+	} else {
+		var ok bool
+		name, ok = namedKeys[strings.ToUpper(base)]
+		if !ok {
+			return Key{}, &KeyError{Spec: spec, Reason: "unknown key", Suggestions: suggest(strings.ToUpper(base), keyNames())}
+		}
+	}
+
+	// Modifiers stack in tmux's C-M-S- order; F13-F24 already carry S-
+	prefix := ""
+	for _, mod := range []string{"C", "M", "S"} {
+		if mods[mod] && !strings.HasPrefix(name, mod+"-") {
+			prefix += mod + "-"
+		}
+	}
+
+	return Key{Spec: body, Name: prefix + name, Repeat: repeat}, nil
+}
+
+// splitRepeat separates a "*N" repeat suffix from a key spec
+func splitRepeat(spec string) (string, int, error) {
+	i := strings.LastIndex(spec, "*")
+	// KP* and a bare "*" are keys, not repeats
+	if i <= 0 || i == len(spec)-1 {
+		return spec, 1, nil
+	}
+
+	n, err := strconv.Atoi(spec[i+1:])
+	if err != nil {
+		return spec, 1, nil
+	}
+	if n < 1 || n > MaxKeyRepeat {
+		return "", 0, &KeyError{Spec: spec, Reason: fmt.Sprintf("repeat count must be between 1 and %d", MaxKeyRepeat)}
+	}
+
+	return spec[:i], n, nil
+}
+
+// Args returns the send-keys arguments that press the key Repeat times
+func (k Key) Args() []string {
+	args := make([]string, k.Repeat)
+	for i := range args {
+		args[i] = k.Name
+	}
+	return args
+}
+
+func keyNames() []string {
+	names := make([]string, 0, len(namedKeys))
+	for name := range namedKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func modifierNames() []string {
+	return []string{"CTRL", "ALT", "META", "SHIFT"}
+}
+
+// suggest returns up to three candidates within a small edit distance of word
+func suggest(word string, candidates []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+
+	limit := 2
+	if len(word) <= 3 {
+		limit = 1
+	}
+
+	var matches []match
+	for _, candidate := range candidates {
+		if d := editDistance(word, candidate); d <= limit {
+			matches = append(matches, match{candidate, d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+
+	var out []string
+	for i := 0; i < len(matches) && i < 3; i++ {
+		out = append(out, matches[i].name)
+	}
+	return out
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,57 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		spec   string
+		name   string
+		repeat int
+	}{
+		{"ENTER", "Enter", 1},
+		{"enter", "Enter", 1},
+		{"F5", "F5", 1},
+		{"F13", "S-F1", 1},
+		{"INSERT", "IC", 1},
+		{"KP7", "KP7", 1},
+		{"KP*", "KP*", 1},
+		{"SHIFT+TAB", "S-Tab", 1},
+		{"CTRL+ALT+DELETE", "C-M-Delete", 1},
+		{"ALT+CTRL+SHIFT+UP", "C-M-S-Up", 1},
+		{"CTRL+F13", "C-S-F1", 1},
+		{"CTRL+C", "C-c", 1},
+		{"ALT+x", "M-x", 1},
+		{"SHIFT+a", "A", 1},
+		{"CTRL++", "C-+", 1},
+		{"DOWN*10", "Down", 10},
+		{"KP**3", "KP*", 3},
+	}
+
+	for _, tt := range tests {
+		key, err := ParseKey(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.name, key.Name, tt.spec)
+		assert.Equal(t, tt.repeat, key.Repeat, tt.spec)
+	}
+}
+
+func TestParseKeyErrors(t *testing.T) {
+	_, err := ParseKey("ENTR")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did you mean ENTER")
+
+	_, err = ParseKey("CTL+c")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CTRL")
+
+	_, err = ParseKey("DOWN*0")
+	assert.Error(t, err)
+
+	_, err = ParseKey("x")
+	assert.Error(t, err, "bare characters are literal text, not keys")
+}
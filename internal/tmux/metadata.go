@@ -0,0 +1,310 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User options holding session metadata. They live in tmux, so they survive
+// server restarts and disappear with their session.
+const (
+	optManaged          = "@mcp-managed"
+	optCommand          = "@mcp-command"
+	optWorkingDir       = "@mcp-working-dir"
+	optShellIntegration = "@mcp-shell-integration"
+	optIntegrationPane  = "@mcp-integration-pane"
+	optAgentProfile     = "@mcp-agent-profile"
+	optTemplate         = "@mcp-template"
+	optDescription      = "@mcp-description"
+	optLabels           = "@mcp-labels"
+)
+
+// SessionMeta is what the server knows about a session it created
+type SessionMeta struct {
+	// Managed is set on sessions created by this server
+	Managed    bool
+	Command    string
+	WorkingDir string
+	// ShellIntegration is set when IntegrationPane records command history
+	ShellIntegration bool
+	IntegrationPane  string
+	AgentProfile     bool
+	// Template is the template the session was created from
+	Template string
+	// Description and Labels are free-form, set by the caller to tell
+	// sessions apart
+	Description string
+	Labels      map[string]string
+}
+
+// options renders the metadata's non-zero fields as user options
+func (m SessionMeta) options() map[string]string {
+	opts := map[string]string{}
+	if m.Managed {
+		opts[optManaged] = "1"
+	}
+	if m.Command != "" {
+		opts[optCommand] = m.Command
+	}
+	if m.WorkingDir != "" {
+		opts[optWorkingDir] = m.WorkingDir
+	}
+	if m.ShellIntegration {
+		opts[optShellIntegration] = "1"
+	}
+	if m.IntegrationPane != "" {
+		opts[optIntegrationPane] = m.IntegrationPane
+	}
+	if m.AgentProfile {
+		opts[optAgentProfile] = "1"
+	}
+	if m.Template != "" {
+		opts[optTemplate] = m.Template
+	}
+	if m.Description != "" {
+		opts[optDescription] = m.Description
+	}
+	if len(m.Labels) > 0 {
+		labels := url.Values{}
+		for name, value := range m.Labels {
+			labels.Set(name, value)
+		}
+		opts[optLabels] = labels.Encode()
+	}
+	return opts
+}
+
+// SetSessionMeta records the non-zero fields of meta on a session, leaving
+// the others as they were
+func SetSessionMeta(ctx context.Context, sessionName string, meta SessionMeta) error {
+	return setSessionOptions(ctx, sessionName, meta.options())
+}
+
+// setSessionOptions sets user options on a session in a single tmux call.
+// Values are escaped so that any text survives a list-sessions line.
+func setSessionOptions(ctx context.Context, sessionName string, opts map[string]string) error {
+	var args []string
+	for name, value := range opts {
+		if len(args) > 0 {
+			args = append(args, ";")
+		}
+		args = append(args, "set-option", "-t", sessionName, name, url.PathEscape(value))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("failed to record session metadata: %w", err)
+	}
+	return nil
+}
+
+// SessionState describes a live session and its metadata
+type SessionState struct {
+	Name     string
+	Windows  int
+	Attached bool
+	Created  time.Time
+	Meta     SessionMeta
+}
+
+// sessionStateFields are read by ListSessionStates, in order
+var sessionStateFields = []string{
+	"#{session_name}", "#{session_windows}", "#{session_attached}", "#{session_created}",
+	"#{" + optManaged + "}", "#{" + optCommand + "}", "#{" + optWorkingDir + "}",
+	"#{" + optShellIntegration + "}", "#{" + optIntegrationPane + "}",
+	"#{" + optAgentProfile + "}", "#{" + optTemplate + "}",
+	"#{" + optDescription + "}", "#{" + optLabels + "}",
+}
+
+// ListSessionStates returns every session on the socket with its metadata.
+// A missing tmux server is reported as no sessions.
+func ListSessionStates(ctx context.Context) ([]SessionState, error) {
+	output, err := run(ctx, "list-sessions", "-F", strings.Join(sessionStateFields, "\t"))
+	if err != nil {
+		if errors.Is(err, ErrNoServer) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// Trailing tabs are empty fields, so only the final newline is trimmed
+	var states []SessionState
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		state, err := parseSessionState(line)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// LookupSessionState returns the named session and its metadata, reporting
+// whether it exists
+func LookupSessionState(ctx context.Context, sessionName string) (SessionState, bool, error) {
+	states, err := ListSessionStates(ctx)
+	if err != nil {
+		return SessionState{}, false, err
+	}
+	for _, state := range states {
+		if state.Name == sessionName {
+			return state, true, nil
+		}
+	}
+	return SessionState{}, false, nil
+}
+
+// parseSessionState parses a line printed with sessionStateFields
+func parseSessionState(line string) (SessionState, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != len(sessionStateFields) {
+		return SessionState{}, fmt.Errorf("unexpected session description %q", line)
+	}
+
+	value := func(i int) string {
+		v, err := url.PathUnescape(fields[i])
+		if err != nil {
+			return fields[i]
+		}
+		return v
+	}
+
+	windows, _ := strconv.Atoi(fields[1])
+	attached, _ := strconv.Atoi(fields[2])
+	created, _ := strconv.ParseInt(fields[3], 10, 64)
+
+	var labels map[string]string
+	if query, err := url.ParseQuery(value(12)); err == nil && len(query) > 0 {
+		labels = make(map[string]string, len(query))
+		for name := range query {
+			labels[name] = query.Get(name)
+		}
+	}
+
+	return SessionState{
+		Name:     fields[0],
+		Windows:  windows,
+		Attached: attached > 0,
+		Created:  time.Unix(created, 0),
+		Meta: SessionMeta{
+			Managed:          fields[4] == "1",
+			Command:          value(5),
+			WorkingDir:       value(6),
+			ShellIntegration: fields[7] == "1",
+			IntegrationPane:  fields[8],
+			AgentProfile:     fields[9] == "1",
+			Template:         value(10),
+			Description:      value(11),
+			Labels:           labels,
+		},
+	}, nil
+}
+
+// pruneGrace protects the files of sessions being created: they are written
+// just before the session exists
+const pruneGrace = time.Minute
+
+// HasLabels reports whether the session carries every label in selector
+func (m SessionMeta) HasLabels(selector map[string]string) bool {
+	for name, value := range selector {
+		if v, ok := m.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ReconcileReport says what Reconcile found and repaired
+type ReconcileReport struct {
+	// Managed and Unmanaged count the live sessions
+	Managed   int
+	Unmanaged int
+	// Pruned are sessions that no longer exist whose files were removed
+	Pruned []string
+	// Repiped are sessions whose command history recording was restarted
+	Repiped []string
+}
+
+// Reconcile brings the server's files in line with the sessions that
+// survived a restart: files of sessions that are gone are removed, and
+// command history recording is restarted where it stopped.
+func Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+
+	states, err := ListSessionStates(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	live := map[string]bool{}
+	for _, state := range states {
+		live[state.Name] = true
+		if !state.Meta.Managed {
+			report.Unmanaged++
+			continue
+		}
+		report.Managed++
+
+		if state.Meta.ShellIntegration && state.Meta.IntegrationPane != "" {
+			repiped, err := resumeRecording(ctx, state.Name, state.Meta.IntegrationPane)
+			if err != nil {
+				return report, err
+			}
+			if repiped {
+				report.Repiped = append(report.Repiped, state.Name)
+			}
+		}
+	}
+
+	// Each session's integration files live in a directory named after it
+	entries, err := os.ReadDir(integrationRoot())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, fmt.Errorf("failed to read shell integration files: %v", err)
+	}
+	for _, entry := range entries {
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil || live[name] {
+			continue
+		}
+		// Another server on the socket may be starting this session
+		if info, err := entry.Info(); err != nil || time.Since(info.ModTime()) < pruneGrace {
+			continue
+		}
+		removeIntegration(name)
+		report.Pruned = append(report.Pruned, name)
+	}
+
+	return report, nil
+}
+
+// resumeRecording restarts pipe-pane on a shell integration pane whose pipe
+// was closed, reporting whether it had to
+func resumeRecording(ctx context.Context, sessionName, pane string) (bool, error) {
+	output, err := run(ctx, "display-message", "-p", "-t", pane, "#{pane_pipe}")
+	if err != nil {
+		if errors.Is(err, ErrTargetNotFound) || errors.Is(err, ErrSessionNotFound) {
+			// The pane was closed; there is nothing left to record
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check session recording: %w", err)
+	}
+	if strings.TrimSpace(output) == "1" {
+		return false, nil
+	}
+
+	if err := recordOutput(ctx, sessionName, pane); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,60 @@
+package tmux
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionMetaOptions(t *testing.T) {
+	assert.Empty(t, SessionMeta{}.options())
+	assert.Equal(t, map[string]string{optTemplate: "dev"}, SessionMeta{Template: "dev"}.options())
+
+	opts := SessionMeta{Managed: true, ShellIntegration: true, IntegrationPane: "%3"}.options()
+	assert.Equal(t, map[string]string{optManaged: "1", optShellIntegration: "1", optIntegrationPane: "%3"}, opts)
+}
+
+func TestParseSessionState(t *testing.T) {
+	fields := []string{"dev", "2", "1", "1700000000", "1",
+		url.PathEscape("make watch\tall"), url.PathEscape("/home/me/my project"),
+		"1", "%4", "", "web", url.PathEscape("API server"), url.PathEscape("project=api&owner=a+b%2Bc")}
+
+	state, err := parseSessionState(strings.Join(fields, "\t"))
+	require.NoError(t, err)
+	assert.Equal(t, "dev", state.Name)
+	assert.Equal(t, 2, state.Windows)
+	assert.True(t, state.Attached)
+	assert.Equal(t, int64(1700000000), state.Created.Unix())
+	assert.Equal(t, SessionMeta{
+		Managed:          true,
+		Command:          "make watch\tall",
+		WorkingDir:       "/home/me/my project",
+		ShellIntegration: true,
+		IntegrationPane:  "%4",
+		Template:         "web",
+		Description:      "API server",
+		Labels:           map[string]string{"project": "api", "owner": "a b+c"},
+	}, state.Meta)
+
+	state, err = parseSessionState("other\t1\t0\t1700000000\t\t\t\t\t\t\t\t\t")
+	require.NoError(t, err)
+	assert.False(t, state.Meta.Managed, "sessions created elsewhere carry no metadata")
+
+	_, err = parseSessionState("short\t1")
+	assert.Error(t, err)
+}
+
+func TestSessionMetaLabels(t *testing.T) {
+	meta := SessionMeta{Labels: map[string]string{"project": "api", "team": "web ui"}}
+
+	opts := meta.options()
+	assert.Equal(t, "project=api&team=web+ui", opts[optLabels])
+
+	assert.True(t, meta.HasLabels(nil))
+	assert.True(t, meta.HasLabels(map[string]string{"team": "web ui"}))
+	assert.False(t, meta.HasLabels(map[string]string{"project": "api", "team": "web"}))
+	assert.False(t, meta.HasLabels(map[string]string{"owner": ""}), "a missing label doesn't match an empty value")
+}
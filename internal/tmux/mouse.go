@@ -0,0 +1,306 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MouseAction is the kind of mouse event to inject
+type MouseAction string
+
+const (
+	MouseClick  MouseAction = "click"
+	MouseScroll MouseAction = "scroll"
+	MouseDrag   MouseAction = "drag"
+)
+
+// mouseButtons maps button names to their xterm button codes
+var mouseButtons = map[string]int{
+	"left":   0,
+	"middle": 1,
+	"right":  2,
+}
+
+// MouseEvent is a click, scroll or drag at pane coordinates. Coordinates are
+// 0-based columns and rows from the top-left of the pane, matching the lines
+// returned by view_session.
+type MouseEvent struct {
+	Action MouseAction
+	// Button is left, middle or right for clicks and drags
+	Button string
+	// Direction is up or down for scrolls
+	Direction string
+	// Count is the number of clicks or scroll steps
+	Count int
+	X, Y  int
+	// ToX and ToY are where a drag ends
+	ToX, ToY int
+}
+
+// MouseMode is the mouse reporting an application has enabled in a pane
+type MouseMode struct {
+	// Enabled is set when any mouse tracking mode is on
+	Enabled bool
+	// SGR is set when the application asked for SGR (1006) encoding
+	SGR           bool
+	Width, Height int
+}
+
+// NewMouseEvent validates a mouse event, filling in the default button.
+// Count has no default: callers set it to 1 when none was given.
+func NewMouseEvent(e MouseEvent) (MouseEvent, error) {
+	if e.Count < 1 || e.Count > MaxKeyRepeat {
+		return MouseEvent{}, fmt.Errorf("mouse count must be between 1 and %d", MaxKeyRepeat)
+	}
+	if e.X < 0 || e.Y < 0 || e.ToX < 0 || e.ToY < 0 {
+		return MouseEvent{}, fmt.Errorf("mouse coordinates must not be negative")
+	}
+
+	switch e.Action {
+	case MouseClick, MouseDrag:
+		if e.Button == "" {
+			e.Button = "left"
+		}
+		if _, ok := mouseButtons[e.Button]; !ok {
+			return MouseEvent{}, fmt.Errorf("unknown mouse button %q (expected left, middle or right)", e.Button)
+		}
+	case MouseScroll:
+		if e.Direction != "up" && e.Direction != "down" {
+			return MouseEvent{}, fmt.Errorf("scroll direction must be up or down, got %q", e.Direction)
+		}
+	default:
+		return MouseEvent{}, fmt.Errorf("unknown mouse action %q (expected click, scroll or drag)", e.Action)
+	}
+
+	return e, nil
+}
+
+// ParseMouse parses a mouse step without its angle brackets:
+// "CLICK 10,5", "CLICK right 10,5", "SCROLL up 3 at 10,5" or "DRAG 1,1 20,1"
+func ParseMouse(cmd string) (MouseEvent, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return MouseEvent{}, fmt.Errorf("empty mouse step")
+	}
+
+	e := MouseEvent{Action: MouseAction(strings.ToLower(fields[0])), Count: 1}
+	args := fields[1:]
+
+	var err error
+	switch e.Action {
+	case MouseClick:
+		// CLICK [button] x,y
+		if len(args) == 2 {
+			e.Button = strings.ToLower(args[0])
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			return MouseEvent{}, fmt.Errorf("invalid click %q, expected <CLICK x,y> or <CLICK right x,y>", cmd)
+		}
+		if e.X, e.Y, err = parsePoint(args[0]); err != nil {
+			return MouseEvent{}, err
+		}
+
+	case MouseScroll:
+		// SCROLL up|down [count] at x,y
+		if len(args) == 4 {
+			if e.Count, err = strconv.Atoi(args[1]); err != nil {
+				return MouseEvent{}, fmt.Errorf("invalid scroll count %q", args[1])
+			}
+			args = append(args[:1], args[2:]...)
+		}
+		if len(args) != 3 || !strings.EqualFold(args[1], "at") {
+			return MouseEvent{}, fmt.Errorf("invalid scroll %q, expected <SCROLL up 3 at x,y>", cmd)
+		}
+		e.Direction = strings.ToLower(args[0])
+		if e.X, e.Y, err = parsePoint(args[2]); err != nil {
+			return MouseEvent{}, err
+		}
+
+	case MouseDrag:
+		// DRAG [button] x1,y1 x2,y2
+		if len(args) == 3 {
+			e.Button = strings.ToLower(args[0])
+			args = args[1:]
+		}
+		if len(args) != 2 {
+			return MouseEvent{}, fmt.Errorf("invalid drag %q, expected <DRAG x1,y1 x2,y2>", cmd)
+		}
+		if e.X, e.Y, err = parsePoint(args[0]); err != nil {
+			return MouseEvent{}, err
+		}
+		if e.ToX, e.ToY, err = parsePoint(args[1]); err != nil {
+			return MouseEvent{}, err
+		}
+	}
+
+	return NewMouseEvent(e)
+}
+
+// isMouseStep reports whether a <COMMAND> body is a mouse step
+func isMouseStep(cmd string) bool {
+	for _, prefix := range []string{"CLICK ", "SCROLL ", "DRAG "} {
+		if strings.HasPrefix(strings.ToUpper(cmd), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePoint parses "x,y"
+func parsePoint(s string) (int, int, error) {
+	xs, ys, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid coordinates %q, expected x,y", s)
+	}
+	x, errX := strconv.Atoi(xs)
+	y, errY := strconv.Atoi(ys)
+	if errX != nil || errY != nil {
+		return 0, 0, fmt.Errorf("invalid coordinates %q, expected x,y", s)
+	}
+	return x, y, nil
+}
+
+// String renders the event in the step DSL
+func (e MouseEvent) String() string {
+	switch e.Action {
+	case MouseScroll:
+		return fmt.Sprintf("<SCROLL %s %d at %d,%d>", e.Direction, e.Count, e.X, e.Y)
+	case MouseDrag:
+		return fmt.Sprintf("<DRAG %s %d,%d %d,%d>", e.Button, e.X, e.Y, e.ToX, e.ToY)
+	}
+	return fmt.Sprintf("<CLICK %s %d,%d>", e.Button, e.X, e.Y)
+}
+
+// Encode returns the bytes an xterm would send for the event, using SGR
+// encoding when the application asked for it and the legacy X10 encoding
+// otherwise
+func (e MouseEvent) Encode(mode MouseMode) ([]byte, error) {
+	if !mode.Enabled {
+		return nil, ErrMouseDisabled
+	}
+	if mode.Width > 0 && (e.X >= mode.Width || e.ToX >= mode.Width || e.Y >= mode.Height || e.ToY >= mode.Height) {
+		return nil, fmt.Errorf("mouse coordinates are outside the %dx%d pane", mode.Width, mode.Height)
+	}
+
+	var out []byte
+	add := func(button, x, y int, release bool) error {
+		seq, err := encodeMouse(mode, button, x, y, release)
+		if err != nil {
+			return err
+		}
+		out = append(out, seq...)
+		return nil
+	}
+
+	switch e.Action {
+	case MouseClick:
+		button := mouseButtons[e.Button]
+		for i := 0; i < e.Count; i++ {
+			if err := add(button, e.X, e.Y, false); err != nil {
+				return nil, err
+			}
+			if err := add(button, e.X, e.Y, true); err != nil {
+				return nil, err
+			}
+		}
+
+	case MouseScroll:
+		button := 64
+		if e.Direction == "down" {
+			button = 65
+		}
+		for i := 0; i < e.Count; i++ {
+			if err := add(button, e.X, e.Y, false); err != nil {
+				return nil, err
+			}
+		}
+
+	case MouseDrag:
+		button := mouseButtons[e.Button]
+		if err := add(button, e.X, e.Y, false); err != nil {
+			return nil, err
+		}
+		// Motion with the button held, one cell at a time along the line
+		steps := max(abs(e.ToX-e.X), abs(e.ToY-e.Y))
+		for i := 1; i <= steps; i++ {
+			x := e.X + (e.ToX-e.X)*i/steps
+			y := e.Y + (e.ToY-e.Y)*i/steps
+			if err := add(button+32, x, y, false); err != nil {
+				return nil, err
+			}
+		}
+		if err := add(button, e.ToX, e.ToY, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(out) > MaxSendBytes {
+		return nil, fmt.Errorf("mouse event is %d bytes, more than the limit of %d", len(out), MaxSendBytes)
+	}
+	return out, nil
+}
+
+// encodeMouse encodes one mouse report at 0-based coordinates
+func encodeMouse(mode MouseMode, button, x, y int, release bool) ([]byte, error) {
+	if mode.SGR {
+		final := 'M'
+		if release {
+			final = 'm'
+		}
+		return []byte(fmt.Sprintf("\x1b[<%d;%d;%d%c", button, x+1, y+1, final)), nil
+	}
+
+	// X10 encoding offsets everything by 32 and cannot report past column 223
+	if x+33 > 255 || y+33 > 255 {
+		return nil, fmt.Errorf("coordinates %d,%d are too large for the application's legacy mouse encoding", x, y)
+	}
+	if release {
+		button = 3
+	}
+	return []byte{0x1b, '[', 'M', byte(button + 32), byte(x + 33), byte(y + 33)}, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// GetMouseMode reads the mouse reporting mode of a session's active pane
+func GetMouseMode(ctx context.Context, sessionName string) (MouseMode, error) {
+	output, err := run(ctx, "display-message", "-p", "-t", sessionName,
+		"#{mouse_any_flag} #{mouse_sgr_flag} #{pane_width} #{pane_height}")
+	if err != nil {
+		return MouseMode{}, fmt.Errorf("failed to read mouse mode: %w", err)
+	}
+
+	var anyFlag, sgrFlag int
+	var mode MouseMode
+	if _, err := fmt.Sscanf(strings.TrimSpace(output), "%d %d %d %d", &anyFlag, &sgrFlag, &mode.Width, &mode.Height); err != nil {
+		return MouseMode{}, fmt.Errorf("failed to parse mouse mode %q: %v", output, err)
+	}
+	mode.Enabled = anyFlag != 0
+	mode.SGR = sgrFlag != 0
+
+	return mode, nil
+}
+
+// SendMouse injects a mouse event into a session, encoded for whatever mouse
+// mode the application in the pane has enabled
+func SendMouse(ctx context.Context, sessionName string, e MouseEvent) error {
+	mode, err := GetMouseMode(ctx, sessionName)
+	if err != nil {
+		return err
+	}
+
+	data, err := e.Encode(mode)
+	if err != nil {
+		return err
+	}
+
+	return SendBytes(ctx, sessionName, data)
+}
@@ -0,0 +1,58 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMouse(t *testing.T) {
+	e, err := ParseMouse("CLICK 10,5")
+	require.NoError(t, err)
+	assert.Equal(t, MouseEvent{Action: MouseClick, Button: "left", Count: 1, X: 10, Y: 5}, e)
+
+	e, err = ParseMouse("SCROLL down 3 at 0,2")
+	require.NoError(t, err)
+	assert.Equal(t, MouseEvent{Action: MouseScroll, Direction: "down", Count: 3, X: 0, Y: 2}, e)
+
+	e, err = ParseMouse("DRAG right 1,1 3,1")
+	require.NoError(t, err)
+	assert.Equal(t, MouseEvent{Action: MouseDrag, Button: "right", Count: 1, X: 1, Y: 1, ToX: 3, ToY: 1}, e)
+
+	for _, cmd := range []string{"CLICK 10", "CLICK wheel 1,1", "SCROLL sideways at 1,1", "DRAG 1,1", "CLICK -1,0", "SCROLL up 0 at 1,1", "SCROLL up -1 at 1,1"} {
+		_, err := ParseMouse(cmd)
+		assert.Error(t, err, cmd)
+	}
+}
+
+func TestNewMouseEventCount(t *testing.T) {
+	_, err := NewMouseEvent(MouseEvent{Action: MouseClick, Count: 0})
+	assert.EqualError(t, err, "mouse count must be between 1 and 1000", "an explicit zero is not replaced by the default")
+
+	_, err = NewMouseEvent(MouseEvent{Action: MouseClick, Count: -1})
+	assert.EqualError(t, err, "mouse count must be between 1 and 1000")
+}
+
+func TestMouseEncode(t *testing.T) {
+	click := MouseEvent{Action: MouseClick, Button: "left", Count: 1, X: 9, Y: 4}
+
+	data, err := click.Encode(MouseMode{Enabled: true, SGR: true, Width: 80, Height: 24})
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[<0;10;5M\x1b[<0;10;5m", string(data))
+
+	data, err = click.Encode(MouseMode{Enabled: true, Width: 80, Height: 24})
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[M *%\x1b[M#*%", string(data))
+
+	drag := MouseEvent{Action: MouseDrag, Button: "left", Count: 1, X: 0, Y: 0, ToX: 2, ToY: 0}
+	data, err = drag.Encode(MouseMode{Enabled: true, SGR: true, Width: 80, Height: 24})
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[<0;1;1M\x1b[<32;2;1M\x1b[<32;3;1M\x1b[<0;3;1m", string(data))
+
+	_, err = click.Encode(MouseMode{Width: 80, Height: 24})
+	assert.ErrorIs(t, err, ErrMouseDisabled)
+
+	_, err = click.Encode(MouseMode{Enabled: true, SGR: true, Width: 5, Height: 5})
+	assert.Error(t, err)
+}
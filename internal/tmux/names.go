@@ -0,0 +1,69 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Words for generated session names, short and easy to tell apart
+var (
+	nameAdjectives = []string{
+		"amber", "bold", "brisk", "calm", "clever", "cosy", "crisp", "eager",
+		"fancy", "gentle", "glad", "golden", "happy", "jolly", "keen", "kind",
+		"lively", "lucky", "mellow", "merry", "nimble", "plucky", "proud", "quick",
+		"quiet", "rapid", "steady", "sunny", "swift", "tidy", "witty", "zesty",
+	}
+	nameNouns = []string{
+		"badger", "beaver", "bison", "crane", "falcon", "ferret", "finch", "fox",
+		"gecko", "heron", "ibis", "koala", "lemur", "lynx", "marten", "moose",
+		"newt", "otter", "owl", "panda", "puffin", "quokka", "raven", "robin",
+		"seal", "shrew", "stoat", "tapir", "toad", "walrus", "wombat", "yak",
+	}
+)
+
+// HasSession reports whether a session with exactly this name exists
+func HasSession(ctx context.Context, sessionName string) (bool, error) {
+	// The = prefix stops tmux matching another session by prefix
+	_, err := run(ctx, "has-session", "-t", "="+sessionName)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrNoServer):
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check for session: %w", err)
+	}
+}
+
+// maxNameSuffix bounds the names UniqueSessionName tries
+const maxNameSuffix = 100
+
+// UniqueSessionName returns base if no session has that name, and otherwise
+// the first of base-2, base-3 and so on up to base-100 that is free
+func UniqueSessionName(ctx context.Context, base string) (string, error) {
+	name := base
+	for i := 2; i <= maxNameSuffix+1; i++ {
+		exists, err := HasSession(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", fmt.Errorf("no free name between %s and %s-%d: %w", base, base, maxNameSuffix, ErrDuplicateSession)
+}
+
+// GenerateSessionName returns an unused, readable name such as
+// agent-calm-otter
+func GenerateSessionName(ctx context.Context, prefix string) (string, error) {
+	return UniqueSessionName(ctx, randomSessionName(prefix))
+}
+
+// randomSessionName joins the prefix to a random adjective and noun
+func randomSessionName(prefix string) string {
+	return fmt.Sprintf("%s-%s-%s", prefix, nameAdjectives[rand.IntN(len(nameAdjectives))], nameNouns[rand.IntN(len(nameNouns))])
+}
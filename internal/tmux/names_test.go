@@ -0,0 +1,13 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomSessionName(t *testing.T) {
+	for range 20 {
+		assert.Regexp(t, `^agent-[a-z]+-[a-z]+$`, randomSessionName("agent"))
+	}
+}
@@ -0,0 +1,86 @@
+package tmux
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// agentPrompt is the agent profile's PS1: short, fixed and easy to match
+const agentPrompt = "$ "
+
+// agentPagers are pointed at cat so nothing waits in less
+var agentPagers = []string{"PAGER", "GIT_PAGER", "MANPAGER", "SYSTEMD_PAGER", "AWS_PAGER"}
+
+// defaultShell is the user's login shell, for features that need to know
+// which shell they start
+func defaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// cleanShellArgs are the arguments that stop shell reading the user's rc files
+func cleanShellArgs(shell string) []string {
+	switch filepath.Base(shell) {
+	case "bash":
+		return []string{"--norc", "--noprofile", "-i"}
+	case "zsh":
+		return []string{"-f", "-i"}
+	default:
+		return []string{"-i"}
+	}
+}
+
+// agentProfileEnv is the environment the agent profile starts the shell with
+func agentProfileEnv(shell string, colors bool) map[string]string {
+	env := map[string]string{
+		"PS1":      agentPrompt,
+		"PS2":      "> ",
+		"HISTFILE": "/dev/null",
+	}
+	for _, name := range agentPagers {
+		env[name] = "cat"
+	}
+	if !colors {
+		env["NO_COLOR"] = "1"
+	}
+	if filepath.Base(shell) != "bash" && filepath.Base(shell) != "zsh" {
+		// POSIX shells read $ENV at startup
+		env["ENV"] = ""
+	}
+	return env
+}
+
+// agentProfileSettings describes what the agent profile applied
+func agentProfileSettings(shell string, colors bool) []string {
+	settings := []string{
+		fmt.Sprintf("shell: %s without rc files", shell),
+		fmt.Sprintf("prompt: PS1=%q", agentPrompt),
+		fmt.Sprintf("pagers: %s set to cat", strings.Join(agentPagers, ", ")),
+		"history: not saved (HISTFILE=/dev/null)",
+	}
+	if colors {
+		settings = append(settings, "colors: enabled")
+	} else {
+		settings = append(settings, "colors: disabled (NO_COLOR=1)")
+	}
+	return settings
+}
+
+// envCommand renders argv as a shell command run with extra environment
+// variables
+func envCommand(env map[string]string, argv []string) string {
+	if len(env) == 0 {
+		return shellJoin(argv)
+	}
+	words := []string{"env"}
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		words = append(words, name+"="+env[name])
+	}
+	return shellJoin(append(words, argv...))
+}
@@ -0,0 +1,23 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvCommand(t *testing.T) {
+	assert.Equal(t, "/bin/bash -i", envCommand(nil, []string{"/bin/bash", "-i"}))
+	assert.Equal(t, "env PAGER=cat 'PS1=$ ' /bin/bash --norc", envCommand(map[string]string{"PAGER": "cat", "PS1": "$ "}, []string{"/bin/bash", "--norc"}))
+}
+
+func TestAgentProfileEnv(t *testing.T) {
+	env := agentProfileEnv("/bin/bash", false)
+	assert.Equal(t, "cat", env["GIT_PAGER"])
+	assert.Equal(t, "1", env["NO_COLOR"])
+	assert.NotContains(t, env, "ENV")
+
+	env = agentProfileEnv("/bin/dash", true)
+	assert.NotContains(t, env, "NO_COLOR")
+	assert.Contains(t, env, "ENV", "POSIX shells skip $ENV")
+}
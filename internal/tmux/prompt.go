@@ -0,0 +1,120 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promptPollInterval is how often WaitForPrompt checks the pane
+const promptPollInterval = 100 * time.Millisecond
+
+// promptSettleChecks is how many consecutive checks must agree, so a
+// command that has been typed but not yet started isn't mistaken for done
+const promptSettleChecks = 2
+
+// DefaultPromptTimeout bounds how long WaitForPrompt waits by default
+const DefaultPromptTimeout = 5 * time.Minute
+
+// PromptResult reports how a pane returned to its prompt
+type PromptResult struct {
+	Elapsed time.Duration
+	// Command is the pane's foreground command once it was back
+	Command string
+	Screen  string
+}
+
+// WaitForPrompt blocks until the pane's shell is back in the foreground, or,
+// when pattern is set, until the last non-empty line of the screen matches
+// it. It fails with ErrConditionNotMet once timeout has passed.
+func WaitForPrompt(ctx context.Context, sessionName string, pattern *Condition, timeout time.Duration) (PromptResult, error) {
+	start := time.Now()
+	agreed := 0
+
+	for {
+		var done bool
+		var command string
+		var err error
+
+		if pattern != nil {
+			done, err = lastLineMatches(ctx, sessionName, *pattern)
+		} else {
+			done, command, err = shellInForeground(ctx, sessionName)
+		}
+		if err != nil {
+			return PromptResult{}, err
+		}
+
+		if done {
+			agreed++
+		} else {
+			agreed = 0
+		}
+
+		if agreed >= promptSettleChecks {
+			screen, err := CapturePane(ctx, sessionName)
+			if err != nil {
+				return PromptResult{}, err
+			}
+			return PromptResult{Elapsed: time.Since(start), Command: command, Screen: screen}, nil
+		}
+
+		if time.Since(start) >= timeout {
+			if pattern != nil {
+				return PromptResult{}, fmt.Errorf("%w: prompt %s did not appear within %s", ErrConditionNotMet, pattern, timeout)
+			}
+			return PromptResult{}, fmt.Errorf("%w: '%s' was still running after %s", ErrConditionNotMet, command, timeout)
+		}
+		if err := sleep(ctx, promptPollInterval); err != nil {
+			return PromptResult{}, err
+		}
+	}
+}
+
+// shellInForeground reports whether the pane's own process, normally the
+// login shell, owns the terminal's foreground process group again. It also
+// returns the name of the current foreground command.
+func shellInForeground(ctx context.Context, sessionName string) (bool, string, error) {
+	output, err := run(ctx, "display-message", "-p", "-t", sessionName, "#{pane_pid} #{pane_current_command}")
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read pane process: %w", err)
+	}
+
+	pidField, command, _ := strings.Cut(strings.TrimSpace(output), " ")
+	pid, err := strconv.Atoi(pidField)
+	if err != nil {
+		return false, "", fmt.Errorf("unexpected pane pid %q", pidField)
+	}
+
+	// The shell is in the foreground when the terminal's foreground process
+	// group is the shell's own
+	out, err := exec.CommandContext(ctx, "ps", "-o", "tpgid=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, "", ctxErr
+		}
+		return false, "", fmt.Errorf("failed to read foreground process group of pid %d: %v", pid, err)
+	}
+	tpgid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return false, "", fmt.Errorf("unexpected foreground process group %q", strings.TrimSpace(string(out)))
+	}
+
+	return tpgid == pid, command, nil
+}
+
+// lastLineMatches tests the condition against the last non-empty screen
+// line. tmux drops trailing spaces when capturing, so a prompt such as
+// ">>> " is matched as ">>>".
+func lastLineMatches(ctx context.Context, sessionName string, cond Condition) (bool, error) {
+	screen, err := CapturePaneWithOptions(ctx, sessionName, CaptureOptions{Plain: true})
+	if err != nil {
+		return false, err
+	}
+
+	lines := strings.Split(strings.TrimRight(screen, "\n "), "\n")
+	return cond.Regexp.MatchString(lines[len(lines)-1]), nil
+}
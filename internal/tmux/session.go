@@ -1,237 +1,390 @@
 package tmux
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// CheckTmuxAvailable verifies tmux is installed and available
-func CheckTmuxAvailable() error {
-	if _, err := exec.LookPath("tmux"); err != nil {
-		return fmt.Errorf("tmux is required but not found in PATH")
+// Config controls how this package talks to tmux
+type Config struct {
+	// SocketName selects a named socket, as in tmux -L
+	SocketName string
+	// SocketPath selects a socket by path, as in tmux -S
+	SocketPath string
+	// Width and Height are the default size of new sessions
+	Width  int
+	Height int
+}
+
+var config = Config{Width: 80, Height: 24}
+
+// Configure sets the socket and defaults used by all subsequent tmux calls
+func Configure(c Config) {
+	if c.Width <= 0 {
+		c.Width = 80
+	}
+	if c.Height <= 0 {
+		c.Height = 24
+	}
+	config = c
+}
+
+// SocketArgs returns the tmux global flags selecting the configured socket
+func SocketArgs() []string {
+	switch {
+	case config.SocketPath != "":
+		return []string{"-S", config.SocketPath}
+	case config.SocketName != "":
+		return []string{"-L", config.SocketName}
 	}
 	return nil
 }
 
-// StartSession creates a new session with the given name
-func StartSession(sessionName, command, workingDir string) error {
-	// Use tmux directly to match the expected sessionName exactly
-	args := []string{"new-session", "-d", "-s", sessionName, "-x", "80", "-y", "24"}
+// SocketFile returns the filesystem path of the configured tmux socket,
+// following tmux's own rules for -L names and the default socket
+func SocketFile() string {
+	if config.SocketPath != "" {
+		return config.SocketPath
+	}
 
-	if workingDir != "" {
-		args = append(args, "-c", workingDir)
+	name := config.SocketName
+	if name == "" {
+		name = "default"
 	}
 
-	if command != "" {
-		args = append(args, command)
+	dir := os.Getenv("TMUX_TMPDIR")
+	if dir == "" {
+		dir = "/tmp"
 	}
 
-	cmd := exec.Command("tmux", args...)
+	return filepath.Join(dir, fmt.Sprintf("tmux-%d", os.Getuid()), name)
+}
+
+// tmuxCommand builds a tmux invocation against the configured socket
+func tmuxCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "tmux", append(SocketArgs(), args...)...)
+}
+
+// run executes a tmux command, returning its stdout or a *CommandError that
+// carries tmux's stderr. If ctx is done the context's error is returned.
+func run(ctx context.Context, args ...string) (string, error) {
+	return runWithInput(ctx, nil, args...)
+}
+
+// runWithInput is run with stdin connected to input
+func runWithInput(ctx context.Context, input io.Reader, args ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	cmd := tmuxCommand(ctx, args...)
+	cmd.Stdin = input
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create tmux session: %v", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", newCommandError(args, stderr.String(), err)
 	}
 
-	// Give the command time to start
-	time.Sleep(200 * time.Millisecond)
+	return stdout.String(), nil
+}
 
+// CheckTmuxAvailable verifies tmux is installed and available
+func CheckTmuxAvailable() error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux is required but not found in PATH")
+	}
 	return nil
 }
 
-// SendKeys sends keystrokes to a session by name
-func SendKeys(sessionName, keys string) error {
-	// Use direct exec.Command to avoid shell injection
-	cmd := exec.Command("tmux", "send-keys", "-t", sessionName, keys)
-	return cmd.Run()
+// StartSession creates a new session with the given name
+func StartSession(ctx context.Context, sessionName, command, workingDir string) error {
+	_, err := StartSessionWithOptions(ctx, sessionName, SessionOptions{Command: command, WorkingDir: workingDir})
+	return err
 }
 
-// SendCommands sends a sequence of commands to a session with enhanced features
-func SendCommands(sessionName string, commands []string, defaultDelayMs int, captureScreen bool) (string, error) {
-	var result strings.Builder
+// SessionOptions controls how a session is started
+type SessionOptions struct {
+	// Command runs instead of the default shell
+	Command    string
+	WorkingDir string
+	// Shell replaces tmux's default shell, and runs Command when both are set
+	Shell string
+	// Env is set in the session's environment
+	Env map[string]string
+	// ShellIntegration starts the user's bash or zsh with OSC 133 prompt
+	// marks and records its output, so CommandHistory can report each
+	// command's output and exit code. It cannot be combined with Command.
+	ShellIntegration bool
+	// AgentProfile starts the shell without the user's rc files, with a
+	// plain prompt, pagers disabled and history not saved
+	AgentProfile bool
+	// Colors leaves colors enabled in the agent profile
+	Colors bool
+	// Description and Labels are recorded on the session for listing and
+	// selecting it later
+	Description string
+	Labels      map[string]string
+}
 
-	result.WriteString(fmt.Sprintf("Executing %d commands on session '%s':\n", len(commands), sessionName))
+// SessionInfo reports how a session was started
+type SessionInfo struct {
+	// Shell is the shell started, unless tmux chose its default shell
+	Shell string
+	// Settings lists what the agent profile applied
+	Settings []string
+}
 
-	for i, command := range commands {
-		// Check if it's a special command
-		if strings.HasPrefix(command, "<") && strings.HasSuffix(command, ">") {
-			err := executeSpecialCommand(sessionName, command)
-			if err != nil {
-				return "", fmt.Errorf("failed to execute command %d ('%s'): %v", i+1, command, err)
-			}
-		} else {
-			// It's literal text - use -l flag for literal UTF-8
-			err := sendLiteralText(sessionName, command)
-			if err != nil {
-				return "", fmt.Errorf("failed to send literal text %d ('%s'): %v", i+1, command, err)
-			}
-		}
+// StartSessionWithOptions creates a new session with the given name
+func StartSessionWithOptions(ctx context.Context, sessionName string, opts SessionOptions) (SessionInfo, error) {
+	var info SessionInfo
 
-		// Apply default delay between commands (except for sleep commands)
-		if defaultDelayMs > 0 && !strings.HasPrefix(command, "<SLEEP") {
-			time.Sleep(time.Duration(defaultDelayMs) * time.Millisecond)
+	if len(opts.Env) > 0 {
+		if err := requireFeature(FeatureSessionEnvironment); err != nil {
+			return info, err
 		}
 	}
+	if opts.ShellIntegration && opts.Command != "" {
+		return info, fmt.Errorf("shell integration starts the shell itself and cannot be combined with a command")
+	}
 
-	result.WriteString("Commands executed successfully.\n")
-
-	// Capture screen if requested
-	if captureScreen {
-		content, err := CapturePane(sessionName)
+	shell := opts.Shell
+	if shell == "" && (opts.ShellIntegration || opts.AgentProfile) {
+		shell = defaultShell()
+	}
+	if shell != "" {
+		path, err := exec.LookPath(shell)
 		if err != nil {
-			result.WriteString(fmt.Sprintf("Warning: Failed to capture screen: %v\n", err))
-		} else {
-			result.WriteString("\nScreen content:\n")
-			result.WriteString(content)
+			return info, fmt.Errorf("shell %q not found", shell)
 		}
+		shell = path
+	}
+	info.Shell = shell
+
+	var env map[string]string
+	var argv []string
+	switch {
+	case opts.ShellIntegration:
+		var err error
+		if env, argv, err = prepareIntegration(sessionName, shell, opts.AgentProfile); err != nil {
+			return info, err
+		}
+	case opts.Command != "" && shell != "":
+		argv = []string{shell, "-c", opts.Command}
+	case opts.AgentProfile:
+		argv = append([]string{shell}, cleanShellArgs(shell)...)
+	case shell != "":
+		argv = []string{shell}
 	}
 
-	return result.String(), nil
-}
-
-// executeSpecialCommand handles <COMMAND> format commands
-func executeSpecialCommand(sessionName, command string) error {
-	// Remove < and > brackets
-	cmd := strings.TrimPrefix(strings.TrimSuffix(command, ">"), "<")
+	if opts.AgentProfile {
+		profile := agentProfileEnv(shell, opts.Colors)
+		info.Settings = agentProfileSettings(shell, opts.Colors)
+
+		// The profile is applied on the command line, after opts.Env, so
+		// variables the caller set explicitly are left out of it
+		var kept []string
+		for _, name := range slices.Sorted(maps.Keys(opts.Env)) {
+			if value, ok := profile[name]; ok {
+				if value != opts.Env[name] {
+					kept = append(kept, name+"="+opts.Env[name])
+				}
+				delete(profile, name)
+			}
+		}
+		if len(kept) > 0 {
+			info.Settings = append(info.Settings, "kept from env: "+strings.Join(kept, ", "))
+		}
 
-	// Handle sleep commands
-	if strings.HasPrefix(cmd, "SLEEP ") {
-		return handleSleepCommand(cmd)
+		maps.Copy(profile, env)
+		env = profile
 	}
 
-	// Map special commands to tmux key names
-	tmuxKey := mapToTmuxKey(cmd)
-	if tmuxKey == "" {
-		return fmt.Errorf("unknown special command: %s", command)
+	command := opts.Command
+	if len(argv) > 0 {
+		command = envCommand(env, argv)
 	}
 
-	// Send the special key using tmux send-keys
-	tmuxCmd := exec.Command("tmux", "send-keys", "-t", sessionName, tmuxKey)
-	return tmuxCmd.Run()
-}
+	// Use tmux directly to match the expected sessionName exactly
+	args := []string{"new-session", "-d", "-s", sessionName,
+		"-x", strconv.Itoa(config.Width), "-y", strconv.Itoa(config.Height)}
 
-// sendLiteralText sends text literally using tmux -l flag
-func sendLiteralText(sessionName, text string) error {
-	tmuxCmd := exec.Command("tmux", "send-keys", "-l", "-t", sessionName, text)
-	return tmuxCmd.Run()
-}
+	if opts.WorkingDir != "" {
+		args = append(args, "-c", opts.WorkingDir)
+	}
 
-// handleSleepCommand processes <SLEEP Xms> or <SLEEP Xs> commands
-func handleSleepCommand(cmd string) error {
-	// Parse "SLEEP 500ms" or "SLEEP 2s"
-	parts := strings.Split(cmd, " ")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid sleep command format: %s", cmd)
+	for _, name := range slices.Sorted(maps.Keys(opts.Env)) {
+		args = append(args, "-e", name+"="+opts.Env[name])
 	}
 
-	timeStr := parts[1]
-	var duration time.Duration
-	var err error
+	if command != "" {
+		args = append(args, command)
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		if opts.ShellIntegration {
+			removeIntegration(sessionName)
+		}
+		return info, fmt.Errorf("failed to create tmux session: %w", err)
+	}
 
-	if strings.HasSuffix(timeStr, "ms") {
-		ms := strings.TrimSuffix(timeStr, "ms")
-		var msInt int
-		if msInt, err = strconv.Atoi(ms); err != nil {
-			return fmt.Errorf("invalid milliseconds value: %s", ms)
+	meta := SessionMeta{
+		Managed:      true,
+		Command:      opts.Command,
+		WorkingDir:   opts.WorkingDir,
+		AgentProfile: opts.AgentProfile,
+		Description:  opts.Description,
+		Labels:       opts.Labels,
+	}
+	if opts.ShellIntegration {
+		// Start recording before the shell prints its first prompt
+		if err := recordOutput(ctx, sessionName, sessionName); err != nil {
+			return info, err
 		}
-		duration = time.Duration(msInt) * time.Millisecond
-	} else if strings.HasSuffix(timeStr, "s") {
-		s := strings.TrimSuffix(timeStr, "s")
-		var seconds float64
-		if seconds, err = strconv.ParseFloat(s, 64); err != nil {
-			return fmt.Errorf("invalid seconds value: %s", s)
+		pane, err := DescribePane(ctx, sessionName)
+		if err != nil {
+			return info, err
 		}
-		duration = time.Duration(seconds * float64(time.Second))
-	} else {
-		return fmt.Errorf("sleep time must end with 'ms' or 's': %s", timeStr)
+		meta.ShellIntegration = true
+		meta.IntegrationPane = pane.ID
+	}
+	if err := SetSessionMeta(ctx, sessionName, meta); err != nil {
+		return info, err
 	}
 
-	time.Sleep(duration)
-	return nil
+	// Give the command time to start
+	return info, sleep(ctx, 200*time.Millisecond)
 }
 
-// mapToTmuxKey maps our special commands to tmux key names
-func mapToTmuxKey(cmd string) string {
-	keyMap := map[string]string{
-		"ENTER":     "Enter",
-		"ESC":       "Escape",
-		"TAB":       "Tab",
-		"BACKSPACE": "BSpace",
-		"DELETE":    "Delete",
-		"UP":        "Up",
-		"DOWN":      "Down",
-		"LEFT":      "Left",
-		"RIGHT":     "Right",
-		"HOME":      "Home",
-		"END":       "End",
-		"PAGEUP":    "PPage",
-		"PAGEDOWN":  "NPage",
-		"SPACE":     "Space",
+// sleep waits for d or until ctx is done, whichever comes first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
+}
 
-	// Handle CTRL+ combinations
-	if strings.HasPrefix(cmd, "CTRL+") {
-		key := strings.TrimPrefix(cmd, "CTRL+")
-		return "C-" + strings.ToLower(key)
+// SendKeys sends keystrokes to a session by name
+func SendKeys(ctx context.Context, sessionName, keys string) error {
+	// Pass keys as a separate argument to avoid shell injection
+	_, err := run(ctx, "send-keys", "-t", sessionName, keys)
+	return err
+}
+
+// CapturePane captures the current screen content of a session by name
+func CapturePane(ctx context.Context, sessionName string) (string, error) {
+	return CapturePaneWithOptions(ctx, sessionName, CaptureOptions{})
+}
+
+// CaptureOptions controls optional capture-pane behaviour
+type CaptureOptions struct {
+	// PreserveTrailingSpaces keeps spaces at the end of each line (tmux 3.1+)
+	PreserveTrailingSpaces bool
+	// Plain omits the escape sequences for colours and attributes
+	Plain bool
+}
+
+// CapturePaneWithOptions captures the screen content of a session by name
+func CapturePaneWithOptions(ctx context.Context, sessionName string, opts CaptureOptions) (string, error) {
+	args := []string{"capture-pane", "-t", sessionName, "-p"}
+	if !opts.Plain {
+		args = append(args, "-e")
+	}
+	if opts.PreserveTrailingSpaces {
+		if err := requireFeature(FeatureCaptureTrailingSpaces); err != nil {
+			return "", err
+		}
+		args = append(args, "-N")
 	}
 
-	// Handle ALT+ combinations
-	if strings.HasPrefix(cmd, "ALT+") {
-		key := strings.TrimPrefix(cmd, "ALT+")
-		return "M-" + strings.ToLower(key)
+	output, err := run(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to capture screen: %w", err)
 	}
 
-	return keyMap[cmd]
+	return output, nil
 }
 
-// CapturePane captures the current screen content of a session by name
-func CapturePane(sessionName string) (string, error) {
-	cmd := exec.Command("tmux", "capture-pane", "-t", sessionName, "-e", "-p")
-	output, err := cmd.Output()
+// ListSessionNames returns the names of all sessions on the configured socket.
+// A missing tmux server is reported as no sessions.
+func ListSessionNames(ctx context.Context) ([]string, error) {
+	output, err := run(ctx, "list-sessions", "-F", "#{session_name}")
 	if err != nil {
-		return "", fmt.Errorf("failed to capture screen: %v", err)
+		if errors.Is(err, ErrNoServer) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			names = append(names, line)
+		}
 	}
 
-	return string(output), nil
+	return names, nil
 }
 
-// ListSessions returns list of active tmux sessions
-func ListSessions() (string, error) {
-	cmd := exec.Command("tmux", "list-sessions")
-	output, err := cmd.Output()
+// ListSessions returns list of active tmux sessions. A missing tmux server
+// is reported as an empty list.
+func ListSessions(ctx context.Context) (string, error) {
+	output, err := run(ctx, "list-sessions")
 	if err != nil {
-		return "", fmt.Errorf("failed to list sessions: %v", err)
+		if errors.Is(err, ErrNoServer) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to list sessions: %w", err)
 	}
 
-	return string(output), nil
+	return output, nil
 }
 
 // JoinSession joins an existing session, optionally with a new name
-func JoinSession(sessionName, newSessionName string) error {
+func JoinSession(ctx context.Context, sessionName, newSessionName string) error {
 	// First check if the session exists
-	cmd := exec.Command("tmux", "has-session", "-t", sessionName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("session '%s' does not exist", sessionName)
+	if _, err := run(ctx, "has-session", "-t", sessionName); err != nil {
+		return fmt.Errorf("session '%s' does not exist: %w", sessionName, err)
 	}
 
 	// If a new session name is provided, create a new session that shares windows with the target
 	if newSessionName != "" {
 		// Create a new session sharing the same session group as the target
-		cmd := exec.Command("tmux", "new-session", "-d", "-s", newSessionName, "-t", sessionName)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to create shared session: %v", err)
+		if _, err := run(ctx, "new-session", "-d", "-s", newSessionName, "-t", sessionName); err != nil {
+			return fmt.Errorf("failed to create shared session: %w", err)
 		}
 	}
 
 	// Give the command time to start
-	time.Sleep(200 * time.Millisecond)
-
-	return nil
+	return sleep(ctx, 200*time.Millisecond)
 }
 
 // KillSession closes a session by name
-func KillSession(sessionName string) error {
-	cmd := exec.Command("tmux", "kill-session", "-t", sessionName)
-	return cmd.Run()
+func KillSession(ctx context.Context, sessionName string) error {
+	if _, err := run(ctx, "kill-session", "-t", sessionName); err != nil {
+		return err
+	}
+	removeIntegration(sessionName)
+	return nil
 }
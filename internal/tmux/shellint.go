@@ -0,0 +1,445 @@
+package tmux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// integrationFunctions emit OSC 133 prompt (A, B), command (C) and exit (D)
+// marks, and OSC 7 for the working directory. They work in bash and zsh;
+// status is a read-only parameter in zsh, so it can't name a local.
+const integrationFunctions = `__tmux_mcp_urlencode() {
+	local LC_ALL=C s=$1 i c
+	for ((i = 0; i < ${#s}; i++)); do
+		c=${s:$i:1}
+		case $c in
+		[a-zA-Z0-9._~/-]) printf '%s' "$c" ;;
+		*) printf '%%%02X' "'$c" ;;
+		esac
+	done
+}
+__tmux_mcp_precmd() {
+	local __tmux_mcp_ret=$?
+	printf '\033]133;D;%s\007\033]7;file://%s%s\007\033]133;A\007' "$__tmux_mcp_ret" "${HOSTNAME:-$HOST}" "$(__tmux_mcp_urlencode "$PWD")"
+}
+__tmux_mcp_mark_command() {
+	printf '\033]133;C;cmdline_url=%s\007' "$(__tmux_mcp_urlencode "$1")"
+}
+`
+
+// bashUserRC loads the user's own configuration, unless the agent profile
+// asked for a clean shell
+const bashUserRC = `[ -f ~/.bashrc ] && . ~/.bashrc
+`
+
+// bashIntegration is used as bash's --rcfile. PS0 runs before each command.
+const bashIntegration = integrationFunctions + `__tmux_mcp_preexec() {
+	__tmux_mcp_mark_command "$(HISTTIMEFORMAT= builtin history 1 | sed 's/^ *[0-9]*[* ] *//')"
+}
+PROMPT_COMMAND="__tmux_mcp_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+PS0='$(__tmux_mcp_preexec)'"${PS0}"
+PS1="${PS1}"'\[\033]133;B\007\]'
+`
+
+// zshUserEnv restores the user's .zshenv; ZDOTDIR still points at the
+// integration directory so that zsh reads zshIntegration as .zshrc
+const zshUserEnv = `[ -f "$HOME/.zshenv" ] && . "$HOME/.zshenv"
+`
+
+// zshUserRC restores ZDOTDIR and loads the user's .zshrc
+const zshUserRC = `ZDOTDIR=$HOME
+[ -f "$HOME/.zshrc" ] && . "$HOME/.zshrc"
+`
+
+// zshIntegration is used as zsh's .zshrc
+const zshIntegration = integrationFunctions + `precmd_functions=(__tmux_mcp_precmd $precmd_functions)
+preexec_functions+=(__tmux_mcp_mark_command)
+PS1="${PS1}%{$(printf '\033]133;B\007')%}"
+`
+
+// integrationHeader starts every generated rc file
+const integrationHeader = "# Shell integration for tmux-mcp-server\n"
+
+// integrationDir is where a session's shell integration files and output
+// log live
+func integrationDir(sessionName string) string {
+	return filepath.Join(integrationRoot(), url.PathEscape(sessionName))
+}
+
+// integrationRoot holds the integration directories of every session on
+// the configured socket
+func integrationRoot() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("tmux-mcp-%d", os.Getuid()), filepath.Base(SocketFile()))
+}
+
+// integrationLog is the file pipe-pane appends a session's output to
+func integrationLog(sessionName string) string {
+	return filepath.Join(integrationDir(sessionName), "output.log")
+}
+
+// prepareIntegration writes the rc files for shell and returns the
+// environment and arguments that start it with integration enabled. A clean
+// shell skips the user's own rc files.
+func prepareIntegration(sessionName, shell string, clean bool) (map[string]string, []string, error) {
+	if filepath.Base(shell) == "bash" {
+		if err := checkBashVersion(shell); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dir := integrationDir(sessionName)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, nil, fmt.Errorf("failed to clear shell integration files: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create shell integration directory: %v", err)
+	}
+
+	files := map[string]string{}
+	var env map[string]string
+	var argv []string
+	switch filepath.Base(shell) {
+	case "bash":
+		// Debian's bash reads /etc/bash.bashrc even with --rcfile, so the
+		// clean prompt is set again here
+		rc := integrationHeader + "PS1=" + shellJoin([]string{agentPrompt}) + "\n" + bashIntegration
+		if !clean {
+			rc = integrationHeader + bashUserRC + bashIntegration
+		}
+		files["bashrc"] = rc
+		argv = []string{shell, "--rcfile", filepath.Join(dir, "bashrc"), "-i"}
+	case "zsh":
+		files[".zshenv"] = integrationHeader
+		files[".zshrc"] = integrationHeader + zshIntegration
+		argv = []string{shell, "-d", "-i"}
+		if !clean {
+			files[".zshenv"] = integrationHeader + zshUserEnv
+			files[".zshrc"] = integrationHeader + zshUserRC + zshIntegration
+			argv = []string{shell, "-i"}
+		}
+		env = map[string]string{"ZDOTDIR": dir}
+	default:
+		return nil, nil, fmt.Errorf("shell integration supports bash and zsh, not %s", shell)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			return nil, nil, fmt.Errorf("failed to write shell integration files: %v", err)
+		}
+	}
+
+	return env, argv, nil
+}
+
+// checkBashVersion makes sure bash has PS0, which bashIntegration relies on
+// to mark commands: without it command history would stay empty
+func checkBashVersion(shell string) error {
+	out, err := exec.Command(shell, "-c", `echo "${BASH_VERSINFO[0]} ${BASH_VERSINFO[1]}"`).Output()
+	if err != nil {
+		return fmt.Errorf("failed to read the version of %s: %v", shell, err)
+	}
+	major, minor, ok := parseBashVersion(string(out))
+	if !ok {
+		return fmt.Errorf("failed to read the version of %s: unexpected output %q", shell, strings.TrimSpace(string(out)))
+	}
+	if major < 4 || major == 4 && minor < 4 {
+		return fmt.Errorf("shell integration needs bash 4.4 or later, but %s is bash %d.%d", shell, major, minor)
+	}
+	return nil
+}
+
+// parseBashVersion parses the major and minor version printed by
+// checkBashVersion
+func parseBashVersion(s string) (int, int, bool) {
+	majorField, minorField, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(majorField)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(minorField)
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// recordOutput pipes a pane's raw output, escape sequences included, to
+// the session's integration log so the prompt marks can be read back. The
+// server binary's record-output command writes the log, keeping it under
+// MaxOutputLog.
+func recordOutput(ctx context.Context, sessionName, target string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the server binary to record output: %v", err)
+	}
+	pipe := shellJoin([]string{exe, RecordCommand, integrationLog(sessionName)})
+	if _, err := run(ctx, "pipe-pane", "-t", target, pipe); err != nil {
+		return fmt.Errorf("failed to record session output: %w", err)
+	}
+	return nil
+}
+
+// removeIntegration deletes a session's shell integration files, if any
+func removeIntegration(sessionName string) {
+	_ = os.RemoveAll(integrationDir(sessionName))
+}
+
+// CommandRecord is one command run in a session with shell integration
+type CommandRecord struct {
+	Command string
+	// Cwd is the directory the command ran in
+	Cwd      string
+	ExitCode int
+	// Finished is false while the command is still running
+	Finished bool
+	// Output is what the command printed, without escape sequences
+	Output string
+}
+
+// CommandHistory returns the commands run in a session with shell
+// integration, oldest first, keeping at most the last limit
+func CommandHistory(sessionName string, limit int) ([]CommandRecord, error) {
+	window := historyWindow
+	if limit <= 0 {
+		window = 2 * MaxOutputLog
+	}
+
+	// Read back from the end of the log until there are more than limit
+	// records: the first one may have started before the part read
+	for ; ; window *= 2 {
+		data, whole, err := readOutputTail(sessionName, window)
+		if err != nil {
+			return nil, err
+		}
+
+		records := parseShellMarks(data)
+		if whole || len(records) > limit {
+			if limit > 0 && len(records) > limit {
+				records = records[len(records)-limit:]
+			}
+			return records, nil
+		}
+	}
+}
+
+// historyWindow is how much of the end of a log CommandHistory reads first
+var historyWindow int64 = 64 << 10
+
+// readOutputTail returns up to the last n bytes a session recorded, across
+// the current and rotated logs, and whether that is all of it
+func readOutputTail(sessionName string, n int64) ([]byte, bool, error) {
+	current := integrationLog(sessionName)
+
+	var data []byte
+	for _, path := range []string{current, current + ".1"} {
+		chunk, whole, err := readFileTail(path, n-int64(len(data)))
+		if err != nil {
+			switch {
+			case !errors.Is(err, os.ErrNotExist):
+				return nil, false, fmt.Errorf("failed to read session output: %v", err)
+			case path == current:
+				return nil, false, ErrNoShellIntegration
+			default:
+				// The log hasn't been rotated yet
+				return data, true, nil
+			}
+		}
+		data = append(chunk, data...)
+		if !whole {
+			return data, false, nil
+		}
+	}
+	return data, true, nil
+}
+
+// readFileTail returns up to the last n bytes of a file, and whether that
+// is all of it
+func readFileTail(path string, n int64) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	size := info.Size()
+	if size <= n {
+		data, err := io.ReadAll(f)
+		return data, true, err
+	}
+
+	data := make([]byte, n)
+	if _, err := f.ReadAt(data, size-n); err != nil {
+		return nil, false, err
+	}
+	return data, false, nil
+}
+
+// MaxOutputLog is the size at which a session's output log is rotated. The
+// previous log is kept, so a session stores at most twice this.
+const MaxOutputLog = 4 << 20
+
+// RecordCommand is the server subcommand pipe-pane runs to record output
+const RecordCommand = "record-output"
+
+// RecordOutput appends everything read from r to the log at path. Once the
+// log reaches limit bytes it is moved to path.1, replacing the previous one,
+// and a new log is started.
+func RecordOutput(r io.Reader, path string, limit int64) error {
+	f, size, err := openOutputLog(path)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if size >= limit {
+				_ = f.Close()
+				if err := os.Rename(path, path+".1"); err != nil {
+					return fmt.Errorf("failed to rotate output log: %v", err)
+				}
+				if f, size, err = openOutputLog(path); err != nil {
+					return err
+				}
+			}
+			written, err := f.Write(buf[:n])
+			size += int64(written)
+			if err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to write output log: %v", err)
+			}
+		}
+		if readErr != nil {
+			_ = f.Close()
+			if errors.Is(readErr, io.EOF) {
+				return nil
+			}
+			return readErr
+		}
+	}
+}
+
+// openOutputLog opens a log for appending and returns its size
+func openOutputLog(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open output log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, fmt.Errorf("failed to open output log: %v", err)
+	}
+	return f, info.Size(), nil
+}
+
+// parseShellMarks extracts command records from raw pane output carrying
+// OSC 133 and OSC 7 marks
+func parseShellMarks(data []byte) []CommandRecord {
+	var records []CommandRecord
+	var current *CommandRecord
+	var output bytes.Buffer
+	cwd := ""
+
+	for len(data) > 0 {
+		start := bytes.Index(data, []byte("\x1b]"))
+		if start < 0 {
+			if current != nil {
+				output.Write(data)
+			}
+			break
+		}
+		if current != nil {
+			output.Write(data[:start])
+		}
+
+		// OSC sequences end with BEL or ST (ESC \)
+		rest := data[start+2:]
+		end, termLen := bytes.IndexByte(rest, '\x07'), 1
+		if st := bytes.Index(rest, []byte("\x1b\\")); st >= 0 && (end < 0 || st < end) {
+			end, termLen = st, 2
+		}
+		if end < 0 {
+			break
+		}
+		payload := string(rest[:end])
+		data = rest[end+termLen:]
+
+		switch {
+		case strings.HasPrefix(payload, "7;"):
+			if u, err := url.Parse(strings.TrimPrefix(payload, "7;")); err == nil {
+				cwd = u.Path
+			}
+
+		case payload == "133;C" || strings.HasPrefix(payload, "133;C;"):
+			record := CommandRecord{Cwd: cwd}
+			for _, param := range strings.Split(payload, ";")[2:] {
+				if v, ok := strings.CutPrefix(param, "cmdline_url="); ok {
+					if command, err := url.PathUnescape(v); err == nil {
+						record.Command = command
+					}
+				}
+			}
+			current = &record
+			output.Reset()
+
+		case strings.HasPrefix(payload, "133;D"):
+			// A D without a C follows an empty command line
+			if current == nil {
+				continue
+			}
+			current.Finished = true
+			if code, err := strconv.Atoi(strings.TrimPrefix(payload, "133;D;")); err == nil {
+				current.ExitCode = code
+			}
+			current.Output = cleanOutput(output.Bytes())
+			records = append(records, *current)
+			current = nil
+		}
+	}
+
+	if current != nil {
+		current.Output = cleanOutput(output.Bytes())
+		records = append(records, *current)
+	}
+	return records
+}
+
+// cleanOutput strips escape sequences and carriage returns from raw output
+func cleanOutput(raw []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == 0x1b && i+1 < len(raw) && raw[i+1] == '[':
+			// CSI: parameters up to a final byte in @-~
+			i += 2
+			for i < len(raw) && (raw[i] < 0x40 || raw[i] > 0x7e) {
+				i++
+			}
+		case c == 0x1b:
+			// Two-byte escape such as ESC =
+			i++
+		case c == '\n' || c == '\t' || c >= 0x20:
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,131 @@
+package tmux
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShellMarks(t *testing.T) {
+	log := "\x1b]133;D;0\x07\x1b]7;file://host/tmp/my%20dir\x07\x1b]133;A\x07$ \x1b]133;B\x07" +
+		"echo hi; false\r\n" +
+		"\x1b]133;C;cmdline_url=echo%20hi%3B%20false\x07\x1b[1mhi\x1b[0m\r\n" +
+		"\x1b]133;D;1\x07\x1b]7;file://host/tmp\x07\x1b]133;A\x07$ \x1b]133;B\x07\r\n" +
+		// An empty command line reports D without C
+		"\x1b]133;D;1\x1b\\\x1b]133;A\x07$ \x1b]133;B\x07sleep 10\r\n" +
+		"\x1b]133;C;cmdline_url=sleep%2010\x07partial"
+
+	records := parseShellMarks([]byte(log))
+	require.Len(t, records, 2)
+
+	assert.Equal(t, CommandRecord{Command: "echo hi; false", Cwd: "/tmp/my dir", ExitCode: 1, Finished: true, Output: "hi"}, records[0])
+	assert.Equal(t, CommandRecord{Command: "sleep 10", Cwd: "/tmp", Output: "partial"}, records[1])
+}
+
+func TestParseShellMarksIncomplete(t *testing.T) {
+	assert.Empty(t, parseShellMarks(nil))
+	assert.Empty(t, parseShellMarks([]byte("plain output without marks")))
+
+	// A mark cut off mid-write is ignored until it is complete
+	records := parseShellMarks([]byte("\x1b]133;C;cmdline_url=ls\x07out\x1b]133;D;"))
+	require.Len(t, records, 1)
+	assert.False(t, records[0].Finished)
+	assert.Equal(t, "out", records[0].Output)
+}
+
+func TestIntegrationFunctions(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh"} {
+		t.Run(shell, func(t *testing.T) {
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				t.Skipf("%s is not installed", shell)
+			}
+
+			script := integrationFunctions + "cd /tmp\nfalse\n__tmux_mcp_precmd\n"
+			out, err := exec.Command(path, "-c", script).CombinedOutput()
+			require.NoError(t, err, string(out))
+			assert.Contains(t, string(out), "\x1b]133;D;1\x07")
+			assert.Contains(t, string(out), "/tmp\x07\x1b]133;A\x07")
+		})
+	}
+}
+
+func TestCheckBashVersion(t *testing.T) {
+	major, minor, ok := parseBashVersion("5 2\n")
+	assert.True(t, ok)
+	assert.Equal(t, []int{5, 2}, []int{major, minor})
+	_, _, ok = parseBashVersion("\n")
+	assert.False(t, ok, "not bash")
+
+	// An old bash, such as macOS's 3.2, is refused up front
+	dir := t.TempDir()
+	old := filepath.Join(dir, "bash")
+	require.NoError(t, os.WriteFile(old, []byte("#!/bin/sh\necho '3 2'\n"), 0o700))
+	_, _, err := prepareIntegration("old-bash", old, false)
+	assert.ErrorContains(t, err, "needs bash 4.4 or later")
+	assert.NoDirExists(t, integrationDir("old-bash"))
+
+	if path, err := exec.LookPath("bash"); err == nil {
+		assert.NoError(t, checkBashVersion(path))
+	}
+}
+
+func TestRecordOutputRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.log")
+
+	err := RecordOutput(iotest.OneByteReader(strings.NewReader("0123456789abcdefghijXYZ")), path, 10)
+	require.NoError(t, err)
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "XYZ", string(current))
+
+	previous, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", string(previous))
+}
+
+func TestCommandHistoryReadsTail(t *testing.T) {
+	sessionName := fmt.Sprintf("test-history-tail-%d", os.Getpid())
+	dir := integrationDir(sessionName)
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	t.Cleanup(func() { removeIntegration(sessionName) })
+
+	_, err := CommandHistory(sessionName, 1)
+	assert.ErrorIs(t, err, ErrNoShellIntegration)
+
+	command := func(i int) string {
+		return fmt.Sprintf("\x1b]7;file://host/tmp\x07\x1b]133;A\x07$ \x1b]133;B\x07"+
+			"\x1b]133;C;cmdline_url=echo%%20%d\x07%d\r\n\x1b]133;D;0\x07", i, i)
+	}
+	var previous, current strings.Builder
+	for i := 1; i <= 50; i++ {
+		previous.WriteString(command(i))
+	}
+	for i := 51; i <= 60; i++ {
+		current.WriteString(command(i))
+	}
+	require.NoError(t, os.WriteFile(integrationLog(sessionName)+".1", []byte(previous.String()), 0o600))
+	require.NoError(t, os.WriteFile(integrationLog(sessionName), []byte(current.String()), 0o600))
+
+	// Start with a window smaller than one record so it has to grow
+	defer func(window int64) { historyWindow = window }(historyWindow)
+	historyWindow = 16
+
+	records, err := CommandHistory(sessionName, 12)
+	require.NoError(t, err)
+	require.Len(t, records, 12)
+	assert.Equal(t, CommandRecord{Command: "echo 49", Cwd: "/tmp", Finished: true, Output: "49"}, records[0])
+	assert.Equal(t, "echo 60", records[11].Command)
+
+	records, err = CommandHistory(sessionName, 0)
+	require.NoError(t, err)
+	assert.Len(t, records, 60)
+}
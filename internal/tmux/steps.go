@@ -0,0 +1,408 @@
+package tmux
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StepKind identifies what a send_commands step does
+type StepKind int
+
+const (
+	// StepText types text literally
+	StepText StepKind = iota
+	// StepKey presses a special key
+	StepKey
+	// StepSleep pauses the sequence
+	StepSleep
+	// StepBytes sends raw bytes
+	StepBytes
+	// StepMouse injects a mouse event
+	StepMouse
+	// StepTypeSlow types text a character at a time
+	StepTypeSlow
+	// StepIf runs the steps up to its <ENDIF> only if the screen matches
+	StepIf
+	// StepEndIf closes an <IF> block
+	StepEndIf
+	// StepUntil repeats the steps up to its <END> until the screen matches
+	StepUntil
+	// StepEnd closes an <UNTIL> loop
+	StepEnd
+	// StepWaitIdle waits until the pane stops changing
+	StepWaitIdle
+)
+
+// Step is one parsed entry of a send_commands sequence
+type Step struct {
+	Kind     StepKind
+	Text     string
+	Key      Key
+	Duration time.Duration
+	Bytes    []byte
+	Mouse    MouseEvent
+	// Condition is tested by <IF> and <UNTIL> steps
+	Condition Condition
+	// Max is the iteration limit of an <UNTIL> loop
+	Max int
+	// Timeout bounds a <WAIT_IDLE> step, whose quiet period is Duration
+	Timeout time.Duration
+}
+
+// String renders the step in the string DSL, escaping text where needed
+func (s Step) String() string {
+	switch s.Kind {
+	case StepKey:
+		if s.Key.Repeat > 1 {
+			return fmt.Sprintf("<%s*%d>", s.Key.Spec, s.Key.Repeat)
+		}
+		return "<" + s.Key.Spec + ">"
+	case StepSleep:
+		return fmt.Sprintf("<SLEEP %dms>", s.Duration.Milliseconds())
+	case StepBytes:
+		return fmt.Sprintf("<HEX %x>", s.Bytes)
+	case StepMouse:
+		return s.Mouse.String()
+	case StepTypeSlow:
+		return "<TYPE_SLOW " + s.Text + ">"
+	case StepIf:
+		return fmt.Sprintf("<IF %s>", s.Condition)
+	case StepEndIf:
+		return "<ENDIF>"
+	case StepUntil:
+		return fmt.Sprintf("<UNTIL %s max=%d>", s.Condition, s.Max)
+	case StepEnd:
+		return "<END>"
+	case StepWaitIdle:
+		return fmt.Sprintf("<WAIT_IDLE %dms max=%dms>", s.Duration.Milliseconds(), s.Timeout.Milliseconds())
+	}
+
+	if isSpecial(s.Text) || isEscaped(s.Text) {
+		return "<" + s.Text
+	}
+	return s.Text
+}
+
+// sendsInput reports whether the step sends anything to the pane, and so is
+// followed by the default delay
+func (s Step) sendsInput() bool {
+	switch s.Kind {
+	case StepText, StepKey, StepBytes, StepMouse, StepTypeSlow:
+		return true
+	}
+	return false
+}
+
+// isSpecial reports whether a string step is written in <COMMAND> form
+func isSpecial(step string) bool {
+	return len(step) >= 2 && strings.HasPrefix(step, "<") && strings.HasSuffix(step, ">") && !strings.HasPrefix(step, "<<")
+}
+
+// isEscaped reports whether a string step is an escaped <COMMAND>: an extra
+// leading "<" in front of text that would otherwise be special or escaped
+func isEscaped(step string) bool {
+	return strings.HasPrefix(step, "<<") && (isSpecial(step[1:]) || isEscaped(step[1:]))
+}
+
+// ParseStep parses the string form of a step. Text is typed literally unless
+// it is wrapped in angle brackets. An extra leading "<" escapes the bracket,
+// so "<<stdin>" types "<stdin>", while text such as "<<EOF" that isn't
+// bracketed is typed as it is.
+func ParseStep(step string) (Step, error) {
+	if isEscaped(step) {
+		return Step{Kind: StepText, Text: step[1:]}, nil
+	}
+
+	if !isSpecial(step) {
+		return Step{Kind: StepText, Text: step}, nil
+	}
+
+	cmd := step[1 : len(step)-1]
+	if strings.HasPrefix(cmd, "SLEEP ") {
+		duration, err := parseSleep(cmd)
+		if err != nil {
+			return Step{}, err
+		}
+		return Step{Kind: StepSleep, Duration: duration}, nil
+	}
+	switch {
+	case strings.HasPrefix(cmd, "IF "):
+		return parseIf(cmd)
+	case strings.HasPrefix(cmd, "UNTIL "):
+		return parseUntil(cmd)
+	case cmd == "ENDIF":
+		return Step{Kind: StepEndIf}, nil
+	case cmd == "END":
+		return Step{Kind: StepEnd}, nil
+	}
+	if cmd == "WAIT_IDLE" || strings.HasPrefix(cmd, "WAIT_IDLE ") {
+		return parseWaitIdle(cmd)
+	}
+	if strings.HasPrefix(cmd, "TYPE_SLOW ") {
+		return Step{Kind: StepTypeSlow, Text: strings.TrimPrefix(cmd, "TYPE_SLOW ")}, nil
+	}
+	if strings.HasPrefix(cmd, "HEX ") {
+		data, err := ParseHex(strings.TrimPrefix(cmd, "HEX "))
+		if err != nil {
+			return Step{}, err
+		}
+		return Step{Kind: StepBytes, Bytes: data}, nil
+	}
+	if isMouseStep(cmd) {
+		event, err := ParseMouse(cmd)
+		if err != nil {
+			return Step{}, err
+		}
+		return Step{Kind: StepMouse, Mouse: event}, nil
+	}
+
+	key, err := ParseKey(cmd)
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{Kind: StepKey, Key: key}, nil
+}
+
+// parseWaitIdle parses "WAIT_IDLE [quiet] [max=timeout]"
+func parseWaitIdle(cmd string) (Step, error) {
+	step := Step{Kind: StepWaitIdle, Duration: DefaultIdleQuiet, Timeout: DefaultIdleMax}
+
+	for _, field := range strings.Fields(cmd)[1:] {
+		if value, ok := strings.CutPrefix(field, "max="); ok {
+			timeout, err := parseSleep("SLEEP " + value)
+			if err != nil {
+				return Step{}, err
+			}
+			step.Timeout = timeout
+			continue
+		}
+
+		quiet, err := parseSleep("SLEEP " + field)
+		if err != nil {
+			return Step{}, err
+		}
+		step.Duration = quiet
+	}
+
+	if step.Duration <= 0 || step.Timeout <= 0 {
+		return Step{}, fmt.Errorf("<WAIT_IDLE> durations must be positive")
+	}
+	return step, nil
+}
+
+// ParseStepObject parses the object form of a step: exactly one of
+// {"text": "..."}, {"type_slow": "..."}, {"key": "ENTER"}, {"sleep": "500ms"}
+// or {"hex": "1b5b41"}. Sleeps also accept a number of milliseconds.
+func ParseStepObject(obj map[string]any) (Step, error) {
+	if len(obj) != 1 {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return Step{}, fmt.Errorf("step object must have exactly one of text, type_slow, key, sleep or hex, got %v", keys)
+	}
+
+	for field, value := range obj {
+		switch field {
+		case "text":
+			text, ok := value.(string)
+			if !ok {
+				return Step{}, fmt.Errorf("text must be a string")
+			}
+			return Step{Kind: StepText, Text: text}, nil
+
+		case "type_slow":
+			text, ok := value.(string)
+			if !ok {
+				return Step{}, fmt.Errorf("type_slow must be a string")
+			}
+			return Step{Kind: StepTypeSlow, Text: text}, nil
+
+		case "key":
+			spec, ok := value.(string)
+			if !ok {
+				return Step{}, fmt.Errorf("key must be a string")
+			}
+			key, err := ParseKey(strings.TrimSuffix(strings.TrimPrefix(spec, "<"), ">"))
+			if err != nil {
+				return Step{}, err
+			}
+			return Step{Kind: StepKey, Key: key}, nil
+
+		case "sleep":
+			switch v := value.(type) {
+			case float64:
+				if v < 0 {
+					return Step{}, fmt.Errorf("sleep must not be negative")
+				}
+				return Step{Kind: StepSleep, Duration: time.Duration(v * float64(time.Millisecond))}, nil
+			case string:
+				duration, err := parseSleep("SLEEP " + v)
+				if err != nil {
+					return Step{}, err
+				}
+				return Step{Kind: StepSleep, Duration: duration}, nil
+			}
+			return Step{}, fmt.Errorf("sleep must be a duration string like \"500ms\" or a number of milliseconds")
+
+		case "hex":
+			digits, ok := value.(string)
+			if !ok {
+				return Step{}, fmt.Errorf("hex must be a string")
+			}
+			data, err := ParseHex(digits)
+			if err != nil {
+				return Step{}, err
+			}
+			return Step{Kind: StepBytes, Bytes: data}, nil
+
+		default:
+			return Step{}, fmt.Errorf("unknown step field %q (expected text, type_slow, key, sleep or hex)", field)
+		}
+	}
+
+	return Step{}, nil
+}
+
+// StepProblem is one invalid step found while parsing a sequence
+type StepProblem struct {
+	// Index is the 1-based position of the step
+	Index int
+	Err   error
+}
+
+// StepsError reports every invalid step in a sequence
+type StepsError struct {
+	Problems []StepProblem
+}
+
+func (e *StepsError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = fmt.Sprintf("step %d: %v", p.Index, p.Err)
+	}
+	return fmt.Sprintf("invalid commands, nothing was sent:\n%s", strings.Join(lines, "\n"))
+}
+
+// ParseSteps parses a sequence of string and object steps, reporting every
+// invalid step with its 1-based index in a *StepsError
+func ParseSteps(items []any) ([]Step, error) {
+	steps := make([]Step, 0, len(items))
+	var problems []StepProblem
+
+	for i, item := range items {
+		var step Step
+		var err error
+
+		switch v := item.(type) {
+		case string:
+			step, err = ParseStep(v)
+		case map[string]any:
+			step, err = ParseStepObject(v)
+		default:
+			err = fmt.Errorf("step must be a string or an object, got %T", item)
+		}
+
+		if err != nil {
+			problems = append(problems, StepProblem{Index: i + 1, Err: err})
+			continue
+		}
+		steps = append(steps, step)
+	}
+
+	if len(problems) > 0 {
+		return nil, &StepsError{Problems: problems}
+	}
+
+	if _, problems := matchBlocks(steps); len(problems) > 0 {
+		return nil, &StepsError{Problems: problems}
+	}
+	return steps, nil
+}
+
+// Invocation returns the tmux arguments that perform the step, or nil for
+// steps that don't map to one send-keys call: sleeps, slow typing, mouse
+// events, whose encoding depends on the pane, and control flow
+func (s Step) Invocation(sessionName string) []string {
+	switch s.Kind {
+	case StepKey:
+		// Send the key, repeated as requested, in a single send-keys call
+		return append([]string{"send-keys", "-t", sessionName}, s.Key.Args()...)
+	case StepText:
+		// Literal text uses the -l flag for literal UTF-8
+		return []string{"send-keys", "-l", "-t", sessionName, s.Text}
+	case StepBytes:
+		return append([]string{"send-keys", "-t", sessionName, "-H"}, hexArgs(s.Bytes)...)
+	}
+	return nil
+}
+
+// DescribePlan renders the tmux invocations and waits that SendCommands
+// would perform, one numbered step per line
+func DescribePlan(sessionName string, steps []Step, opts SendOptions) string {
+	var b strings.Builder
+	blocks, _ := matchBlocks(steps)
+
+	b.WriteString(fmt.Sprintf("Plan for %d commands on session '%s':\n", len(steps), sessionName))
+	for i, step := range steps {
+		switch step.Kind {
+		case StepSleep:
+			b.WriteString(fmt.Sprintf("%d. sleep %s\n", i+1, step.Duration))
+		case StepMouse:
+			b.WriteString(fmt.Sprintf("%d. mouse %s, sent with send-keys -H in the pane's mouse encoding\n", i+1, step))
+		case StepTypeSlow:
+			b.WriteString(fmt.Sprintf("%d. type %s one character at a time, %s apart\n", i+1, shellJoin([]string{step.Text}), opts.typingDelay()))
+		case StepIf:
+			b.WriteString(fmt.Sprintf("%d. if the screen matches %s, continue; otherwise skip to step %d\n", i+1, step.Condition, blocks[i]+2))
+		case StepUntil:
+			b.WriteString(fmt.Sprintf("%d. until the screen matches %s, run steps %d-%d (at most %d times)\n", i+1, step.Condition, i+2, blocks[i], step.Max))
+		case StepWaitIdle:
+			b.WriteString(fmt.Sprintf("%d. wait until the screen is unchanged for %s (at most %s)\n", i+1, step.Duration, step.Timeout))
+		case StepEndIf, StepEnd:
+			b.WriteString(fmt.Sprintf("%d. %s\n", i+1, step))
+		case StepText:
+			if opts.TypingDelay > 0 {
+				b.WriteString(fmt.Sprintf("%d. type %s one character at a time, %s apart\n", i+1, shellJoin([]string{step.Text}), opts.TypingDelay))
+				break
+			}
+			fallthrough
+		default:
+			b.WriteString(fmt.Sprintf("%d. %s\n", i+1, shellJoin(append(append([]string{"tmux"}, SocketArgs()...), step.Invocation(sessionName)...))))
+		}
+
+		if opts.DefaultDelay > 0 && step.sendsInput() {
+			b.WriteString(fmt.Sprintf("   sleep %s (default delay)\n", opts.DefaultDelay))
+		}
+	}
+
+	if opts.CaptureScreen {
+		b.WriteString(fmt.Sprintf("then: %s\n", shellJoin(append(append([]string{"tmux"}, SocketArgs()...), "capture-pane", "-t", sessionName, "-e", "-p"))))
+	}
+
+	return b.String()
+}
+
+// shellJoin quotes arguments for display as a shell command line
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ParseStepStrings parses a sequence written entirely in the string form
+func ParseStepStrings(commands []string) ([]Step, error) {
+	items := make([]any, len(commands))
+	for i, command := range commands {
+		items[i] = command
+	}
+	return ParseSteps(items)
+}
@@ -0,0 +1,136 @@
+package tmux
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStep(t *testing.T) {
+	step, err := ParseStep("<ENTER>")
+	require.NoError(t, err)
+	assert.Equal(t, StepKey, step.Kind)
+	assert.Equal(t, "Enter", step.Key.Name)
+
+	step, err = ParseStep("<SLEEP 250ms>")
+	require.NoError(t, err)
+	assert.Equal(t, StepSleep, step.Kind)
+	assert.Equal(t, 250*time.Millisecond, step.Duration)
+
+	step, err = ParseStep("<WAIT_IDLE 1s max=90s>")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepWaitIdle, Duration: time.Second, Timeout: 90 * time.Second}, step)
+
+	step, err = ParseStep("<<stdin>")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "<stdin>"}, step)
+
+	step, err = ParseStep("<<<stdin>")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "<<stdin>"}, step)
+
+	// Unbracketed text is never an escape
+	step, err = ParseStep("<<EOF")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "<<EOF"}, step)
+
+	step, err = ParseStep("<<<word")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "<<<word"}, step)
+
+	step, err = ParseStep("cat < input.txt")
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "cat < input.txt"}, step)
+}
+
+func TestParseStepObject(t *testing.T) {
+	step, err := ParseStepObject(map[string]any{"text": "<div>"})
+	require.NoError(t, err)
+	assert.Equal(t, Step{Kind: StepText, Text: "<div>"}, step)
+
+	step, err = ParseStepObject(map[string]any{"key": "CTRL+c"})
+	require.NoError(t, err)
+	assert.Equal(t, "C-c", step.Key.Name)
+
+	step, err = ParseStepObject(map[string]any{"sleep": float64(1500)})
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, step.Duration)
+
+	_, err = ParseStepObject(map[string]any{"text": "a", "key": "ENTER"})
+	assert.Error(t, err)
+
+	_, err = ParseStepObject(map[string]any{"type": "a"})
+	assert.Error(t, err)
+}
+
+func TestParseStepsReportsEveryProblem(t *testing.T) {
+	_, err := ParseSteps([]any{"ls", "<ENTR>", "<SLEEP 2sec>", map[string]any{"key": "ENTER"}, 42})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step 2: invalid key <ENTR>")
+	assert.Contains(t, err.Error(), "step 3:")
+	assert.Contains(t, err.Error(), "step 5:")
+}
+
+func TestStepStringRoundTrips(t *testing.T) {
+	for _, input := range []string{"ls -la", "<<stdin>", "<<<stdin>", "<<EOF", "<<<word", "<ENTER>", "<DOWN*3>", "<SLEEP 90000ms>", "<HEX 1b5b41>", "<TYPE_SLOW a > b>", "<WAIT_IDLE 200ms max=5000ms>"} {
+		step, err := ParseStep(input)
+		require.NoError(t, err, input)
+
+		again, err := ParseStep(step.String())
+		require.NoError(t, err, input)
+		assert.Equal(t, step, again, input)
+	}
+}
+
+func TestDescribePlan(t *testing.T) {
+	steps, err := ParseSteps([]any{"echo 'hi'", "<ENTER>", "<SLEEP 500ms>"})
+	require.NoError(t, err)
+
+	plan := DescribePlan("dev", steps, SendOptions{DefaultDelay: 100 * time.Millisecond})
+	assert.Contains(t, plan, `1. tmux send-keys -l -t dev 'echo '\''hi'\'''`)
+	assert.Contains(t, plan, "2. tmux send-keys -t dev Enter")
+	assert.Contains(t, plan, "3. sleep 500ms")
+	assert.Equal(t, 2, strings.Count(plan, "(default delay)"))
+}
+
+func TestParseHex(t *testing.T) {
+	data, err := ParseHex("1b 5B41")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1b, '[', 'A'}, data)
+
+	for _, input := range []string{"", "1b5", "zz", strings.Repeat("00", MaxSendBytes+1)} {
+		_, err := ParseHex(input)
+		assert.Error(t, err, input)
+	}
+
+	step, err := ParseStep("<HEX 03>")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"send-keys", "-t", "dev", "-H", "03"}, step.Invocation("dev"))
+}
+
+func TestParseControlFlow(t *testing.T) {
+	steps, err := ParseStepStrings([]string{"<IF /Overwrite\\? \\[y\\/N\\]/i>", "y", "<ENDIF>", "<UNTIL /main\\.go/ max=20>", "<DOWN>", "<END>"})
+	require.NoError(t, err)
+	assert.Equal(t, StepIf, steps[0].Kind)
+	assert.True(t, steps[0].Condition.Regexp.MatchString("overwrite? [Y/n]\noverwrite? [y/N]"))
+	assert.Equal(t, 20, steps[3].Max)
+	assert.Equal(t, "<UNTIL /main\\.go/ max=20>", steps[3].String())
+
+	blocks, problems := matchBlocks(steps)
+	assert.Empty(t, problems)
+	assert.Equal(t, 2, blocks[0])
+	assert.Equal(t, 3, blocks[5])
+
+	_, err = ParseStepStrings([]string{"<IF /a/>", "<END>", "<UNTIL /b/ max=0>", "<IF /(/>"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step 3: max must be between")
+	assert.Contains(t, err.Error(), "step 4: invalid condition")
+
+	_, err = ParseStepStrings([]string{"<IF /a/>", "<END>"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step 2: <END> without a matching <UNTIL>")
+	assert.Contains(t, err.Error(), "step 1: <IF> is never closed with <ENDIF>")
+}
@@ -0,0 +1,69 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultTypingDelay is the per-character delay of <TYPE_SLOW> steps when no
+// typing delay is set
+const DefaultTypingDelay = 50 * time.Millisecond
+
+// typist types text one character at a time. It sends over a single control
+// mode connection when tmux supports one, and falls back to a tmux process
+// per character otherwise.
+type typist struct {
+	sessionName string
+	control     *controlClient
+	tried       bool
+}
+
+// send runs one tmux command for the typist
+func (t *typist) send(ctx context.Context, args ...string) error {
+	if !t.tried {
+		t.tried = true
+		if c, err := openControlClient(ctx, t.sessionName); err == nil {
+			t.control = c
+		}
+	}
+
+	if t.control != nil {
+		return t.control.run(args...)
+	}
+	_, err := run(ctx, args...)
+	return err
+}
+
+// typeText sends text a character at a time with delay between characters
+func (t *typist) typeText(ctx context.Context, text string, delay time.Duration) error {
+	first := true
+	for _, r := range text {
+		if !first {
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		var err error
+		if r < 0x20 || r == 0x7f {
+			// Control characters can't be quoted on a control mode command line
+			err = t.send(ctx, "send-keys", "-t", t.sessionName, "-H", fmt.Sprintf("%02x", r))
+		} else {
+			err = t.send(ctx, "send-keys", "-l", "-t", t.sessionName, string(r))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close detaches the control mode connection, if one was opened
+func (t *typist) Close() {
+	if t.control != nil {
+		_ = t.control.Close()
+		t.control = nil
+	}
+}
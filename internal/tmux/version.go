@@ -0,0 +1,147 @@
+package tmux
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is a parsed tmux version such as 3.3a
+type Version struct {
+	Major  int
+	Minor  int
+	Suffix string
+}
+
+// MinimumVersion is the oldest tmux this server supports. It is the first
+// release with send-keys -H and reliable sizing of detached sessions.
+var MinimumVersion = Version{Major: 3, Minor: 0}
+
+// String formats the version the way tmux -V does
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d%s", v.Major, v.Minor, v.Suffix)
+}
+
+// AtLeast reports whether v is the same as or newer than other, ignoring suffixes
+func (v Version) AtLeast(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	return v.Minor >= other.Minor
+}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)([a-z]?)`)
+
+// ParseVersion parses the output of tmux -V, e.g. "tmux 3.3a", "tmux next-3.5"
+// or "tmux 3.4-rc". Builds from master report no number and are treated as
+// newer than any release.
+func ParseVersion(output string) (Version, error) {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "tmux ") {
+		return Version{}, fmt.Errorf("unrecognised tmux version output %q", output)
+	}
+
+	if strings.TrimPrefix(output, "tmux ") == "master" {
+		return Version{Major: 999}, nil
+	}
+
+	m := versionPattern.FindStringSubmatch(output)
+	if m == nil {
+		return Version{}, fmt.Errorf("unrecognised tmux version output %q", output)
+	}
+
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return Version{Major: major, Minor: minor, Suffix: m[3]}, nil
+}
+
+// Feature is a tmux capability that depends on the tmux version
+type Feature struct {
+	Name string
+	Min  Version
+}
+
+// Features used by this package that are newer than MinimumVersion
+var (
+	FeatureCaptureTrailingSpaces = Feature{Name: "capture-pane -N", Min: Version{Major: 3, Minor: 1}}
+	FeatureSessionEnvironment    = Feature{Name: "new-session -e", Min: Version{Major: 3, Minor: 2}}
+	FeatureControlFlags          = Feature{Name: "attach-session -f", Min: Version{Major: 3, Minor: 2}}
+	FeatureSplitPercent          = Feature{Name: "split-window -l N%", Min: Version{Major: 3, Minor: 1}}
+)
+
+// Features lists every gated feature, for reporting
+var Features = []Feature{
+	FeatureCaptureTrailingSpaces,
+	FeatureSessionEnvironment,
+	FeatureControlFlags,
+	FeatureSplitPercent,
+}
+
+// Capabilities describes what the installed tmux supports
+type Capabilities struct {
+	Version Version
+}
+
+// Supports reports whether the feature is available
+func (c Capabilities) Supports(f Feature) bool {
+	return c.Version.AtLeast(f.Min)
+}
+
+// UnsupportedError is returned when an operation needs a newer tmux
+type UnsupportedError struct {
+	Feature Feature
+	Version Version
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is unsupported by tmux %s (requires %s or later)", e.Feature.Name, e.Version, e.Feature.Min)
+}
+
+var (
+	capsMu sync.RWMutex
+	caps   = Capabilities{Version: MinimumVersion}
+)
+
+// DetectCapabilities runs tmux -V and records the result for feature checks.
+// It fails if tmux is older than MinimumVersion.
+func DetectCapabilities() (Capabilities, error) {
+	output, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to run tmux -V: %v", err)
+	}
+
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	detected := Capabilities{Version: version}
+	if !version.AtLeast(MinimumVersion) {
+		return detected, fmt.Errorf("tmux %s is too old: version %s or later is required", version, MinimumVersion)
+	}
+
+	capsMu.Lock()
+	caps = detected
+	capsMu.Unlock()
+
+	return detected, nil
+}
+
+// CurrentCapabilities returns the capabilities recorded by DetectCapabilities
+func CurrentCapabilities() Capabilities {
+	capsMu.RLock()
+	defer capsMu.RUnlock()
+	return caps
+}
+
+// requireFeature returns an UnsupportedError if the feature is unavailable
+func requireFeature(f Feature) error {
+	c := CurrentCapabilities()
+	if !c.Supports(f) {
+		return &UnsupportedError{Feature: f, Version: c.Version}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Version
+	}{
+		{"tmux 3.3a\n", Version{Major: 3, Minor: 3, Suffix: "a"}},
+		{"tmux 3.0", Version{Major: 3, Minor: 0}},
+		{"tmux next-3.5", Version{Major: 3, Minor: 5}},
+		{"tmux 3.4-rc", Version{Major: 3, Minor: 4}},
+		{"tmux master", Version{Major: 999}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.input)
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, got, tt.input)
+	}
+
+	_, err := ParseVersion("screen 4.09")
+	assert.Error(t, err)
+}
+
+func TestCapabilities(t *testing.T) {
+	old := Capabilities{Version: Version{Major: 3, Minor: 0}}
+	assert.False(t, old.Supports(FeatureSessionEnvironment))
+	assert.True(t, Version{Major: 3, Minor: 2}.AtLeast(FeatureSessionEnvironment.Min))
+
+	err := &UnsupportedError{Feature: FeatureCaptureTrailingSpaces, Version: old.Version}
+	assert.Equal(t, "capture-pane -N is unsupported by tmux 3.0 (requires 3.1 or later)", err.Error())
+}
@@ -0,0 +1,174 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// paneFormat identifies a new pane and where it lives
+const paneFormat = "#{pane_id}\t#{session_name}:#{window_index}.#{pane_index}\t#{window_name}"
+
+// Pane is a pane created by NewWindow or SplitWindow
+type Pane struct {
+	// ID is tmux's stable pane id, such as %3
+	ID string
+	// Target addresses the pane in other tools, as session:window.pane
+	Target string
+	Window string
+}
+
+// WindowOptions controls how a window or pane is created
+type WindowOptions struct {
+	// Name names a new window; it is ignored when splitting
+	Name string
+	// Command runs instead of the default shell
+	Command    string
+	WorkingDir string
+	// Env is set in the new pane's environment
+	Env map[string]string
+}
+
+// args renders the options shared by new-window and split-window, up to the
+// command
+func (o WindowOptions) args() ([]string, error) {
+	var args []string
+	if o.WorkingDir != "" {
+		args = append(args, "-c", o.WorkingDir)
+	}
+	if len(o.Env) > 0 {
+		if err := requireFeature(FeatureSessionEnvironment); err != nil {
+			return nil, err
+		}
+		for _, name := range slices.Sorted(maps.Keys(o.Env)) {
+			args = append(args, "-e", name+"="+o.Env[name])
+		}
+	}
+	return args, nil
+}
+
+// NewWindow adds a window to a session
+func NewWindow(ctx context.Context, sessionName string, opts WindowOptions) (Pane, error) {
+	extra, err := opts.args()
+	if err != nil {
+		return Pane{}, err
+	}
+
+	// A trailing colon targets the session rather than a window in it
+	args := append([]string{"new-window", "-d", "-P", "-F", paneFormat, "-t", sessionName + ":"}, extra...)
+	if opts.Name != "" {
+		args = append(args, "-n", opts.Name)
+	}
+	if opts.Command != "" {
+		args = append(args, opts.Command)
+	}
+
+	output, err := run(ctx, args...)
+	if err != nil {
+		return Pane{}, fmt.Errorf("failed to create window: %w", err)
+	}
+	return parsePane(output)
+}
+
+// SplitOptions controls how SplitWindow divides a pane
+type SplitOptions struct {
+	WindowOptions
+	// Horizontal places the new pane beside the target rather than below it
+	Horizontal bool
+	// Percent is the new pane's share of the target, or zero for half
+	Percent int
+}
+
+// SplitWindow splits the target pane in two, returning the new pane
+func SplitWindow(ctx context.Context, target string, opts SplitOptions) (Pane, error) {
+	extra, err := opts.args()
+	if err != nil {
+		return Pane{}, err
+	}
+
+	args := []string{"split-window", "-d", "-P", "-F", paneFormat, "-t", target}
+	if opts.Horizontal {
+		args = append(args, "-h")
+	} else {
+		args = append(args, "-v")
+	}
+	if opts.Percent > 0 {
+		if opts.Percent >= 100 {
+			return Pane{}, fmt.Errorf("split percent must be between 1 and 99, got %d", opts.Percent)
+		}
+		if CurrentCapabilities().Supports(FeatureSplitPercent) {
+			args = append(args, "-l", strconv.Itoa(opts.Percent)+"%")
+		} else {
+			args = append(args, "-p", strconv.Itoa(opts.Percent))
+		}
+	}
+	args = append(args, extra...)
+	if opts.Command != "" {
+		args = append(args, opts.Command)
+	}
+
+	output, err := run(ctx, args...)
+	if err != nil {
+		return Pane{}, fmt.Errorf("failed to split pane: %w", err)
+	}
+	return parsePane(output)
+}
+
+// RespawnPane restarts the target pane with new options, killing what runs
+// in it
+func RespawnPane(ctx context.Context, target string, opts WindowOptions) error {
+	extra, err := opts.args()
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"respawn-pane", "-k", "-t", target}, extra...)
+	if opts.Command != "" {
+		args = append(args, opts.Command)
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("failed to respawn pane: %w", err)
+	}
+	return nil
+}
+
+// DescribePane returns the pane target refers to. A session name refers to
+// the active pane of its current window, which for a new session is its only
+// pane.
+func DescribePane(ctx context.Context, target string) (Pane, error) {
+	output, err := run(ctx, "display-message", "-p", "-t", target, paneFormat)
+	if err != nil {
+		return Pane{}, fmt.Errorf("failed to find pane: %w", err)
+	}
+	return parsePane(output)
+}
+
+// RenameWindow renames the window containing target
+func RenameWindow(ctx context.Context, target, name string) error {
+	if _, err := run(ctx, "rename-window", "-t", target, name); err != nil {
+		return fmt.Errorf("failed to rename window: %w", err)
+	}
+	return nil
+}
+
+// SelectLayout arranges the panes of the window containing target using one
+// of tmux's layouts, such as tiled or main-vertical
+func SelectLayout(ctx context.Context, target, layout string) error {
+	if _, err := run(ctx, "select-layout", "-t", target, layout); err != nil {
+		return fmt.Errorf("failed to select layout %q: %w", layout, err)
+	}
+	return nil
+}
+
+// parsePane parses a line printed with paneFormat
+func parsePane(output string) (Pane, error) {
+	fields := strings.SplitN(strings.TrimSpace(output), "\t", 3)
+	if len(fields) != 3 {
+		return Pane{}, fmt.Errorf("unexpected pane description %q", strings.TrimSpace(output))
+	}
+	return Pane{ID: fields[0], Target: fields[1], Window: fields[2]}, nil
+}